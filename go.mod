@@ -1,12 +1,16 @@
 module github.com/nobeans/replace-word
 
-go 1.17
+go 1.21
 
-require github.com/fatih/color v1.13.0
+require (
+	github.com/fatih/color v1.13.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/hexops/gotextdiff v1.0.3
+	golang.org/x/net v0.20.0
+)
 
 require (
-	github.com/hexops/gotextdiff v1.0.3 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.16 // indirect
-	golang.org/x/sys v0.2.0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
 )
@@ -1,385 +1,3860 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
+	"github.com/fsnotify/fsnotify"
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
 	"github.com/hexops/gotextdiff/span"
+	"golang.org/x/net/html"
+)
+
+// output is where the progress of replacement is written.
+var output io.Writer = os.Stdout
+
+// messages is where the headings and other operational messages are written apart from diffs.
+var messages io.Writer = os.Stdout
+
+// logger logs the operational messages as structured records instead of messages with -log-format.
+var logger *slog.Logger
+
+// addColor and removeColor are the colors of the added and removed text, which can be changed with -color-add and -color-remove.
+var (
+	addColor    = color.FgGreen
+	removeColor = color.FgRed
 )
 
 func main() {
-	targetDir, before, after, dryRun, err := parseArgs()
+	opts, err := parseArgs()
 	if err != nil {
 		printError(err.Error())
 		flag.Usage()
 		os.Exit(1)
 	}
-
-	paths, err := findTargetFiles(targetDir)
-	if err != nil {
-		printError(err.Error())
-		os.Exit(1)
+	if opts.helpForms {
+		printCaseForms("user-profile")
+		return
 	}
-	if len(paths) == 0 {
-		printError("no target files")
-		os.Exit(1)
+	addColor, removeColor = colorNames[opts.colorAdd], colorNames[opts.colorRemove]
+	if opts.format == "json" || opts.format == "jsonl" || opts.format == "patch" {
+		// Only the JSON report or the patch is written to stdout
+		output = io.Discard
+		messages = io.Discard
+	}
+	if opts.logFormat != "" {
+		logger = newLogger(opts.logFormat)
+		messages = io.Discard
+	}
+	if opts.check {
+		// Only the files to be changed are listed
+		output = io.Discard
+		messages = io.Discard
 	}
-	fmt.Println(colorize(color.FgCyan, ">> Target files"))
-	fmt.Println(strings.Join(paths, "\n"))
-
-	textDict := generateDictForText(before, after)
-	fmt.Println(colorize(color.FgCyan, ">> Dictionary for text replacement"))
-	fmt.Println(textDict)
-
-	fileNameDict := generateDictForFileName(before, after)
-	fmt.Println(colorize(color.FgCyan, ">> Dictionary for file rename"))
-	fmt.Println(fileNameDict)
 
-	if dryRun {
-		fmt.Println(colorize(color.FgYellow, "Dry running..."))
-	} else {
-		fmt.Print(colorize(color.FgYellow, "Do you replace words, sure? [y/N]: "))
-		if strings.ToLower(readInput()) != "y" {
-			fmt.Println("Cancelled.")
-			os.Exit(0)
+	baseDirs := []string{opts.dir}
+	if opts.archive != "" {
+		// The entries of the archive are processed instead of the files under dirs
+		baseDirs = nil
+	} else if opts.filesFrom == "" {
+		baseDirs, err = expandTargetDirs(opts.dir)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
 		}
 	}
+	opts.rootDir = commonDir(baseDirs)
 
-	fmt.Println(colorize(color.FgCyan, ">> Replacing text..."))
-	if err := replaceText(paths, textDict, dryRun); err != nil {
-		printError(err.Error())
-		os.Exit(1)
+	scanStart := time.Now()
+	var files []targetFile
+	for _, baseDir := range baseDirs {
+		var found []targetFile
+		if opts.filesFrom != "" {
+			found, err = readTargetFiles(opts.filesFrom, opts)
+		} else {
+			found, err = findTargetFiles(baseDir, 0, opts)
+		}
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		for i := range found {
+			found[i].baseDir = baseDir
+		}
+		files = append(files, found...)
 	}
-
-	fmt.Println(colorize(color.FgCyan, ">> Renaming files and dirs..."))
-	if err := renameFilesAndDirs(targetDir, paths, fileNameDict, dryRun); err != nil {
-		printError(err.Error())
+	scanElapsed := time.Since(scanStart)
+	if opts.debugDetect {
+		return
+	}
+	// Skipped files are found with -outcomes only to be reported, and binary files with -rename-binary only to be renamed
+	scanned := files
+	renameTargets := unskippedFiles(files)
+	files = textFiles(files)
+	if len(renameTargets) == 0 && opts.archive == "" {
+		if opts.filtered() && !opts.errorOnEmpty {
+			printWarn("no target files")
+			os.Exit(0)
+		}
+		printError("no target files")
 		os.Exit(1)
 	}
-}
-
-func parseArgs() (string, string, string, bool, error) {
-	dir := flag.String("dir", ".", "Target directory")
-	dryRun := flag.Bool("dry-run", false, "Enable dry run")
-	flag.Usage = func() {
-		o := flag.CommandLine.Output()
-		_, name := filepath.Split(flag.CommandLine.Name())
-		_, _ = fmt.Fprintf(o, "Usage: %s <hyphenated-before-words> <hyphenated-after-words>\n\nOptions:\n", name)
-		flag.PrintDefaults()
+	if opts.dumpTargets {
+		var paths []string
+		for _, file := range files {
+			paths = append(paths, file.path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		return
 	}
-	flag.Parse()
-	if flag.NArg() != 2 {
-		return "", "", "", false, errors.New("required two arguments")
+	fmt.Fprintln(messages, colorize(color.FgCyan, ">> Target files"))
+	if opts.archive != "" {
+		fmt.Fprintln(messages, opts.archive)
 	}
-	return *dir, flag.Arg(0), flag.Arg(1), *dryRun, nil
-}
-
-func findTargetFiles(dir string) ([]string, error) {
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		return nil, err
+	for _, file := range files {
+		fmt.Fprintln(messages, file.path)
+		logInfo("target file", "path", file.path)
 	}
 
-	var paths []string
-loop:
-	for _, file := range files {
-		path := filepath.Join(dir, file.Name())
+	var customDict dict
+	if opts.dictFile != "" {
+		customDict, err = readDictFile(opts.dictFile)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
 
-		if isDir(file, path) {
-			// Ignore specified dirs
-			for _, ignore := range []string{".idea", ".git", "node_modules", "build", "public"} {
-				if file.Name() == ignore {
-					continue loop
-				}
+	var textDict dict
+	if !opts.renameOnly {
+		textDict = generateDictForText(opts.before, opts.after).ordered(opts.formOrder)
+		if opts.regex {
+			textDict = generateDictForRegex(opts.before, opts.after)
+		}
+		if opts.literal {
+			textDict = generateDictForLiteral(opts.before, opts.after)
+		}
+		if opts.dictFile != "" {
+			textDict = customDict
+		}
+		fmt.Fprintln(messages, colorize(color.FgCyan, ">> Dictionary for text replacement"))
+		fmt.Fprintln(messages, textDict.trimmedIf(opts.trimDict).describe(opts.showForms))
+		logInfo("dictionary", "kind", "text", "items", textDict)
+		if opts.binaryStrings {
+			if err := validateBinaryStrings(textDict); err != nil {
+				printError(err.Error())
+				os.Exit(1)
 			}
+		}
+	}
 
-			foundInChild, err := findTargetFiles(path)
-			if err != nil {
-				return nil, err
-			}
+	fileNameDict := generateDictForFileName(opts.before, opts.after)
+	if opts.renameWithTextDict {
+		// The space separated forms are included for file names which contain spaces
+		fileNameDict = generateDictForText(opts.before, opts.after)
+	}
+	if opts.fileNameForm != "" {
+		fileNameDict = generateDictForForm(opts.before, opts.after, opts.fileNameForm)
+	}
+	if opts.renameSeparator != nil {
+		fileNameDict = fileNameDict.withSeparator(*opts.renameSeparator)
+	}
+	if opts.regex {
+		fileNameDict = generateDictForRegex(opts.before, opts.after)
+	}
+	if opts.literal {
+		fileNameDict = generateDictForLiteral(opts.before, opts.after)
+	}
+	if opts.dictFile != "" {
+		fileNameDict = customDict
+	}
+	fmt.Fprintln(messages, colorize(color.FgCyan, ">> Dictionary for file rename"))
+	fmt.Fprintln(messages, fileNameDict.trimmedIf(opts.trimDict).describe(opts.showForms))
+	logInfo("dictionary", "kind", "fileName", "items", fileNameDict)
 
-			paths = append(paths, foundInChild...)
-			continue
+	if word, ok := shortestWord(textDict, fileNameDict); ok && utf8.RuneCountInString(word) < opts.minWordLength {
+		if !opts.force {
+			printError("%q is shorter than %d characters, which may replace unrelated text (use -force to proceed anyway)", word, opts.minWordLength)
+			os.Exit(1)
 		}
+		printWarn("%q is shorter than %d characters, which may replace unrelated text", word, opts.minWordLength)
+	}
 
-		// Ignore binary files
-		bs, err := os.ReadFile(path)
-		if err != nil {
-			return nil, err
+	if opts.dictionaryOut != "" {
+		// The dictionaries are written as they are applied, i.e. trimmed with -trim-dict
+		if err := writeDictionaries(opts.dictionaryOut, textDict.trimmedIf(opts.trimDict), fileNameDict.trimmedIf(opts.trimDict)); err != nil {
+			printError(err.Error())
+			os.Exit(1)
 		}
-		if !strings.HasPrefix(http.DetectContentType(bs), "text/") {
-			continue
-		}
-
-		paths = append(paths, path)
 	}
-	sort.Strings(paths)
-	return paths, nil
-}
 
-func isDir(file os.DirEntry, path string) bool {
-	fileInfo, err := file.Info()
-	if err != nil {
-		return false
+	if opts.dryRun && opts.renameOnly {
+		fmt.Fprintln(messages, colorize(color.FgYellow, "Dry running only renames..."))
+	} else if opts.dryRun {
+		fmt.Fprintln(messages, colorize(color.FgYellow, "Dry running..."))
+	} else {
+		if opts.archive == "" {
+			changedFiles, replacements, renames := estimateImpact(baseDirs, renameTargets, textDict, fileNameDict, opts)
+			fmt.Fprintln(messages, colorize(color.FgYellow, "%d files, %d replacements, %d renames will be applied", changedFiles, replacements, renames))
+		}
+		in, closeInput, err := confirmationInput(opts)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		confirmed := confirm(in, output, opts.prompt)
+		closeInput()
+		if !confirmed {
+			fmt.Fprintln(messages, "Cancelled.")
+			os.Exit(0)
+		}
 	}
 
-	if fileInfo.Mode()&os.ModeSymlink != 0 {
-		linkPath, err := os.Readlink(path)
-		if err != nil {
-			return false
+	if opts.archive != "" {
+		fmt.Fprintln(messages, colorize(color.FgCyan, ">> Replacing in archive..."))
+		if err := replaceArchive(opts.archive, textDict, fileNameDict, opts); err != nil {
+			printError(err.Error())
+			os.Exit(1)
 		}
+		return
+	}
 
-		targetInfo, err := os.Stat(linkPath)
+	var results, skippedResults []fileResult
+	replaceStart := time.Now()
+	if !opts.renameOnly {
+		fmt.Fprintln(messages, colorize(color.FgCyan, ">> Replacing text..."))
+		results, skippedResults, err = replaceText(files, textDict, opts)
 		if err != nil {
-			return false
+			printError(err.Error())
+			os.Exit(1)
 		}
+	}
+	replaceElapsed := time.Since(replaceStart)
 
-		return targetInfo.IsDir()
+	if opts.sample > 0 {
+		os.Exit(0)
 	}
 
-	return file.IsDir()
-}
+	if opts.outcomes {
+		printOutcomes(scanned, results, skippedResults)
+	}
 
-type dict struct {
-	items []dictItem
-}
+	if opts.rewriteSymlinks {
+		fmt.Fprintln(messages, colorize(color.FgCyan, ">> Rewriting symlinks..."))
+		for _, baseDir := range baseDirs {
+			if err := rewriteSymlinks(baseDir, fileNameDict, opts); err != nil {
+				printError(err.Error())
+				os.Exit(1)
+			}
+		}
+	}
 
-type dictItem struct {
-	before string
-	after  string
-}
+	fmt.Fprintln(messages, colorize(color.FgCyan, ">> Renaming files and dirs..."))
+	renameStart := time.Now()
+	var renames []renameResult
+	renameFailed := false
+	var confirmer *renameConfirmer
+	closeInput := func() {}
+	if opts.confirmRenames {
+		var in io.Reader
+		in, closeInput, err = confirmationInput(opts)
+		if err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+		confirmer = &renameConfirmer{in: in, out: output}
+	}
+	for _, baseDir := range baseDirs {
+		renamed, err := renameFilesAndDirs(baseDir, filesUnder(baseDir, renameTargets), fileNameDict, confirmer, opts)
+		if err != nil {
+			printError(err.Error())
+			if !opts.keepGoing {
+				os.Exit(1)
+			}
+			renameFailed = true
+		}
+		renames = append(renames, renamed...)
+	}
+	closeInput()
+	if renameFailed {
+		os.Exit(1)
+	}
+	// The script is written once for the renames under all the base dirs
+	if opts.renameScript != "" {
+		if err := writeRenameScript(opts.renameScript, renames); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
+	renameElapsed := time.Since(renameStart)
 
-func (d dict) String() string {
-	var its []string
-	var ambiguous bool
-	for _, it := range d.items {
-		s := it.String()
-		for _, itt := range its {
-			if s == itt {
-				ambiguous = true
+	if opts.checkReferences && len(renames) > 0 {
+		fmt.Fprintln(messages, colorize(color.FgCyan, ">> Checking references..."))
+		for _, baseDir := range baseDirs {
+			if err := checkReferences(baseDir, renames, opts); err != nil {
+				printError(err.Error())
+				os.Exit(1)
 			}
 		}
-		its = append(its, s)
 	}
-	if ambiguous {
-		its = append(its, colorize(color.FgYellow, "WARN: dictionary is ambiguous"))
-		its = append(its, colorize(color.FgYellow, "HINT: It may cause unexpected result. You'd better add another word at least."))
+
+	if opts.reportFile != "" {
+		if err := writeReport(opts.reportFile, results, renames, opts); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
 	}
-	return strings.Join(its, "\n")
-}
 
-func (di dictItem) String() string {
-	return fmt.Sprintf(`"%s" => "%s"`, di.before, di.after)
-}
+	if opts.renameMap != "" {
+		if err := writeRenameMap(opts.renameMap, renames); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
 
-func generateDictForText(before string, after string) dict {
-	return dict{
-		items: []dictItem{
-			{before: upperCamelCase(before), after: upperCamelCase(after)},                                   // UpperCamelCase
-			{before: lowerCamelCase(before), after: lowerCamelCase(after)},                                   // lowerCamelCase
-			{before: screamingSnakeCase(before), after: screamingSnakeCase(after)},                           // SCREAMING_SNAKE_CASE
-			{before: snakeCase(before), after: snakeCase(after)},                                             // snake_case
-			{before: screamingKebabCase(before), after: screamingKebabCase(after)},                           // SCREAMING-KEBAB-CASE
-			{before: kebabCase(before), after: kebabCase(after)},                                             // kebab-case
-			{before: noSign(screamingKebabCase(before)), after: noSign(screamingKebabCase(after))},           // flatcase
-			{before: noSign(kebabCase(before)), after: noSign(kebabCase(after))},                             // UPPERCASE
-			{before: upperSpaceSeparated(before), after: upperSpaceSeparated(after)},                         // Upper Space Separated
-			{before: capitalize(lowerSpaceSeparated(before)), after: capitalize(lowerSpaceSeparated(after))}, // Lower space separated
-			{before: lowerSpaceSeparated(before), after: lowerSpaceSeparated(after)},                         // lower space separated
-		},
+	if opts.check && printFilesToBeChanged(results, renames) > 0 {
+		os.Exit(1)
 	}
-}
 
-func generateDictForFileName(before string, after string) dict {
-	return dict{
-		items: []dictItem{
-			{before: upperCamelCase(before), after: upperCamelCase(after)},                         // UpperCamelCase
-			{before: lowerCamelCase(before), after: lowerCamelCase(after)},                         // lowerCamelCase
-			{before: screamingSnakeCase(before), after: screamingSnakeCase(after)},                 // SCREAMING_SNAKE_CASE
-			{before: snakeCase(before), after: snakeCase(after)},                                   // snake_case
-			{before: screamingKebabCase(before), after: screamingKebabCase(after)},                 // SCREAMING-KEBAB-CASE
-			{before: kebabCase(before), after: kebabCase(after)},                                   // kebab-case
-			{before: noSign(screamingKebabCase(before)), after: noSign(screamingKebabCase(after))}, // flatcase
-			{before: noSign(kebabCase(before)), after: noSign(kebabCase(after))},                   // UPPERCASE
-		},
+	if opts.format == "json" {
+		if err := printJSONReport(results, renames); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
 	}
-}
 
-func upperCamelCase(str string) string {
-	var words []string
-	for _, w := range strings.Split(str, "-") {
-		words = append(words, capitalize(w))
+	if opts.timing {
+		printTiming(len(files), scanElapsed, replaceElapsed, renameElapsed)
 	}
-	return strings.Join(words, "")
-}
 
-func lowerCamelCase(str string) string {
-	return decapitalize(upperCamelCase(str))
+	if opts.watch {
+		if err := watch(baseDirs, textDict, opts); err != nil {
+			printError(err.Error())
+			os.Exit(1)
+		}
+	}
 }
 
-func screamingSnakeCase(str string) string {
-	return strings.ToUpper(regexp.MustCompile(`-`).ReplaceAllString(str, "_"))
-}
+type options struct {
+	dir            string
+	before         string
+	after          string
+	dryRun         bool
+	filesFrom      string
+	detectBinary   bool
+	forceText      listFlag
+	textExtensions listFlag
+	include        listFlag
+	includeName    listFlag
+	exclude        listFlag
 
-func snakeCase(str string) string {
-	return strings.ToLower(regexp.MustCompile(`-`).ReplaceAllString(str, "_"))
-}
+	// rootDir is the common ancestor of the dirs matched by -dir, which the paths in patches and -diff-dir are relative to
+	rootDir string
 
-func screamingKebabCase(str string) string {
-	return strings.ToUpper(str)
-}
+	fileNameForm string
+	errorOnEmpty bool
+	expandEnv    bool
+	maxDepth     int
+	strict       bool
 
-func kebabCase(str string) string {
-	return strings.ToLower(str)
-}
+	modifiedSince time.Duration
+	modifiedAfter time.Time
 
-func noSign(str string) string {
-	return regexp.MustCompile(`[_-]`).ReplaceAllString(str, "")
-}
+	exactFileName      bool
+	keepExtension      bool
+	ignoreCaseFileName bool
+	timing             bool
 
-func upperSpaceSeparated(str string) string {
-	var words []string
-	for _, w := range strings.Split(str, "-") {
-		words = append(words, capitalize(w))
-	}
-	return strings.Join(words, " ")
-}
+	dictionaryOut string
 
-func lowerSpaceSeparated(str string) string {
-	return regexp.MustCompile(`[_-]`).ReplaceAllString(str, " ")
+	onRename             string
+	ignoreOnRenameErrors bool
+	rewriteSymlinks      bool
+	renameOnly           bool
+	renameScript         string
+
+	skipFrontMatter    bool
+	envMode            bool
+	jsonValuesOnly     bool
+	htmlAttr           string
+	commentsOnly       bool
+	preserveAlignment  bool
+	renameSeparator    *string
+	firstOnly          bool
+	smartCase          bool
+	prompt             string
+	confirmRenames     bool
+	logFormat          string
+	collisionSuffix    bool
+	checkReferences    bool
+	twoPass            bool
+	diffDir            string
+	showForms          bool
+	trimDict           bool
+	watch              bool
+	check              bool
+	regionStart        string
+	regionEnd          string
+	onlyRegion         bool
+	noRecurse          bool
+	reportFile         string
+	renameMap          string
+	allowPartialWord   bool
+	archive            string
+	archiveOut         string
+	formOrder          listFlag
+	helpForms          bool
+	regex              bool
+	dumpTargets        bool
+	debugDetect        bool
+	dictFile           string
+	literal            bool
+	stripBOM           bool
+	renameWithTextDict bool
+	strictUTF8         bool
+	contextPattern     string
+	collectErrors      bool
+	keepGoing          bool
+	prose              bool
+	gzip               bool
+	binaryStrings      bool
+	renameBinary       bool
+	outcomes           bool
+	jobs               int
+	tree               bool
+
+	maxReplacementsPerFile int
+	maxDiffLines           int
+	formsFor               formsForFlag
+	sample                 int
+	preserveMtime          bool
+	format                 string
+	diffAlgo               string
+	colorAdd               string
+	colorRemove            string
+	assertClean            bool
+	requireAllForms        bool
+	minWordLength          int
+	force                  bool
 }
 
-func capitalize(str string) string {
-	for i, v := range str {
-		return string(unicode.ToUpper(v)) + str[i+1:]
-	}
-	return ""
+// filtered reports whether the target files are narrowed by any filter option.
+func (o options) filtered() bool {
+	return len(o.include) > 0 || len(o.includeName) > 0 || len(o.exclude) > 0
 }
 
-func decapitalize(str string) string {
-	for i, v := range str {
-		return string(unicode.ToLower(v)) + str[i+1:]
+// included reports whether the file passes -include and -include-name, which pass all files if neither is specified.
+func (o options) included(path string) bool {
+	if len(o.include) == 0 && len(o.includeName) == 0 {
+		return true
 	}
-	return ""
+	if matchAny(o.include, path) {
+		return true
+	}
+	for _, name := range o.includeName {
+		if filepath.Base(path) == name {
+			return true
+		}
+	}
+	return false
 }
 
-func readInput() string {
-	scanner := bufio.NewScanner(os.Stdin)
-	scanner.Scan()
-	return scanner.Text()
-}
+// listFlag is a flag value which accepts comma-separated values and can be specified multiple times.
+type listFlag []string
 
-func replaceText(paths []string, dict dict, dryRun bool) error {
-	for _, path := range paths {
-		bs, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
 
-		beforeText := string(bs)
-		afterText := beforeText
-		for _, it := range dict.items {
-			afterText = strings.ReplaceAll(afterText, it.before, it.after)
-		}
-		if beforeText == afterText {
-			continue
+func (f *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*f = append(*f, v)
 		}
+	}
+	return nil
+}
 
-		if !dryRun {
-			if err := os.WriteFile(path, []byte(afterText), 0); err != nil {
-				return err
-			}
-		}
+// formsForFlag is a flag value which maps file extensions to case forms, e.g. ".go:upper-camel,lower-camel".
+type formsForFlag map[string][]string
 
-		fmt.Println(diffText(path, beforeText, afterText))
+func (f *formsForFlag) String() string {
+	var mappings []string
+	for ext, forms := range *f {
+		mappings = append(mappings, ext+":"+strings.Join(forms, ","))
 	}
-	return nil
+	sort.Strings(mappings)
+	return strings.Join(mappings, " ")
 }
 
-func diffText(path string, a string, b string) string {
-	edits := myers.ComputeEdits(span.URIFromPath(path), a, b)
-	diff := fmt.Sprint(gotextdiff.ToUnified("a/"+path, "b/"+path, a, edits))
-	diff = regexp.MustCompile(`(?m)^-.*$`).ReplaceAllStringFunc(diff, func(s string) string {
-		if strings.HasPrefix(s, "---") {
-			return s
+func (f *formsForFlag) Set(value string) error {
+	mapping := strings.SplitN(value, ":", 2)
+	if len(mapping) != 2 || mapping[0] == "" || mapping[1] == "" {
+		return fmt.Errorf("must be <ext>:<forms>: %s", value)
+	}
+	ext := mapping[0]
+	for _, name := range strings.Split(mapping[1], ",") {
+		if _, ok := findCaseForm(name); !ok {
+			return fmt.Errorf("unknown form: %s (available: %s)", name, strings.Join(caseFormNames(), ", "))
 		}
-		return colorize(color.FgRed, s)
-	})
-	diff = regexp.MustCompile(`(?m)^\+.*$`).ReplaceAllStringFunc(diff, func(s string) string {
-		if strings.HasPrefix(s, "+++") {
-			return s
+		if *f == nil {
+			*f = formsForFlag{}
 		}
-		return colorize(color.FgGreen, s)
-	})
-	return diff
+		(*f)[ext] = append((*f)[ext], name)
+	}
+	return nil
 }
 
-func renameFilesAndDirs(baseDir string, paths []string, dict dict, dryRun bool) error {
-	// e.g. ["aaa/bbb/ccc.txt"] -> ["aaa/bbb/ccc.txt", "aaa/bbb", "aaa"] (sorted from leaf to root)
-	var expandedPaths []string
-	found := map[string]bool{}
-	for _, path := range paths {
-		for _, expanded := range expandAncestorDirs(baseDir, path) {
-			if !found[expanded] {
-				found[expanded] = true
-				expandedPaths = append(expandedPaths, expanded)
-			}
+func parseArgs() (options, error) {
+	var opts options
+	flag.StringVar(&opts.dir, "dir", ".", "Target directory, which can be a glob pattern matching multiple dirs")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "Enable dry run")
+	flag.BoolVar(&opts.check, "check", false, "List the files to be changed without changing them, and exit with 1 if any")
+	flag.BoolVar(&opts.outcomes, "outcomes", false, "Dry run reporting the outcome of every scanned file, which is to be changed, has no match or is skipped with the reason")
+	setRenameSeparator := func(sep string) error {
+		if strings.ContainsAny(sep, `/\`) {
+			return fmt.Errorf("invalid separator: %q", sep)
 		}
+		opts.renameSeparator = &sep
+		return nil
 	}
-	sort.Slice(expandedPaths, func(i, j int) bool {
-		return expandedPaths[i] > expandedPaths[j]
-	})
-
-	for _, beforePath := range expandedPaths {
-		dir, beforeFile := filepath.Split(beforePath)
-		dir = filepath.Dir(dir)
-
-		afterFile := beforeFile
-		for _, it := range dict.items {
-			afterFile = strings.ReplaceAll(afterFile, it.before, it.after)
+	flag.Func("rename-separator", "The `separator` between words of renamed file names in the separated forms, e.g. _ to rename user-profile.txt to member_account.txt", setRenameSeparator)
+	flag.Func("normalize-sep", "Same as -rename-separator, which normalizes the `separator` of the renamed file names matched in any separated form", setRenameSeparator)
+	flag.StringVar(&opts.prompt, "prompt", "Do you replace words, sure?", "The `message` of the confirmation prompt before replacing")
+	flag.BoolVar(&opts.confirmRenames, "confirm-renames", false, "Confirm each rename of a file or dir with yes, no, all or quit")
+	flag.StringVar(&opts.archive, "archive", "", "Replace words in the entries of the .zip or .tar `file` instead of the files under -dir")
+	flag.StringVar(&opts.archiveOut, "archive-out", "", "Write the new archive of -archive to the `file` instead of overwriting it")
+	flag.StringVar(&opts.filesFrom, "files-from", "", "Read the target files from the `file` listing a path per line instead of scanning -dir (\"-\": stdin)")
+	flag.BoolVar(&opts.detectBinary, "detect-binary", false, "Skip binary files listed in -files-from as well")
+	flag.Var(&opts.textExtensions, "text-extensions", "File `extensions` treated as text regardless of content sniffing, e.g. .proto,.tmpl (comma-separated, repeatable)")
+	flag.Var(&opts.forceText, "force-text", "Glob `patterns` of files treated as text regardless of content sniffing (comma-separated, repeatable)")
+	flag.Var(&opts.include, "include", "Glob `patterns` of files to process (comma-separated, repeatable)")
+	flag.Var(&opts.includeName, "include-name", "Exact base `names` of files to process in addition to -include, e.g. Makefile,Dockerfile (comma-separated, repeatable)")
+	flag.Var(&opts.exclude, "exclude", "Glob `patterns` of files and dirs to skip (comma-separated, repeatable)")
+	flag.IntVar(&opts.maxDepth, "max-depth", -1, "Max `depth` of dirs to descend (0: only files directly in the target dir, -1: unlimited)")
+	flag.DurationVar(&opts.modifiedSince, "modified-since", 0, "Process only files modified within the `duration`, e.g. 24h (0: all files)")
+	flag.BoolVar(&opts.noRecurse, "no-recurse", false, "Process only files directly in the target dir (same as -max-depth=0)")
+	flag.BoolVar(&opts.strictUTF8, "strict-utf8", false, "Skip text files which are not valid UTF-8, or fail on them with -strict")
+	flag.BoolVar(&opts.collectErrors, "collect-errors", false, "Process all the files even if some fail, and print the errors grouped by kind at the end")
+	flag.BoolVar(&opts.keepGoing, "keep-going", false, "Rename the rest of the files and dirs even if some renames fail, and print the failures at the end")
+	flag.BoolVar(&opts.strict, "strict", false, "Fail on an unreadable file or dir instead of skipping it")
+	flag.BoolVar(&opts.errorOnEmpty, "error-on-empty", false, "Fail even if no target files are found as a result of -include/-exclude")
+	flag.BoolVar(&opts.expandEnv, "expand-env", false, "Expand $VAR or ${VAR} in the arguments with environment variables")
+	flag.BoolVar(&opts.exactFileName, "exact-filename", false, "Rename only files and dirs whose name without extension exactly equals a word")
+	flag.BoolVar(&opts.keepExtension, "keep-extension", false, "Don't replace words in the extensions of file names")
+	flag.BoolVar(&opts.ignoreCaseFileName, "ignore-case-filename", false, "Match words in file names case-insensitively")
+	flag.BoolVar(&opts.watch, "watch", false, "Keep watching the target dirs after the run and replace words in added or modified files")
+	flag.BoolVar(&opts.timing, "timing", false, "Print elapsed time of each phase to stderr")
+	flag.BoolVar(&opts.showForms, "show-forms", false, "Label each item of the printed dictionaries with its case form")
+	flag.BoolVar(&opts.trimDict, "trim-dict", false, "Remove the forms identical to another form from the dictionaries, which would apply the same words twice. A form identical to the raw input is kept once to replace the word as typed")
+	flag.StringVar(&opts.renameMap, "rename-map", "", "Write a JSON object which maps the old paths of the renamed files and dirs to their final paths to the `file`")
+	flag.StringVar(&opts.reportFile, "report-file", "", "Write a human-readable summary of the changed files and renames to the `file` regardless of -format")
+	flag.StringVar(&opts.dictionaryOut, "dictionary-out", "", "Write the generated dictionaries as JSON to the `file`")
+	flag.StringVar(&opts.onRename, "on-rename", "", "Shell `command` run after each rename, where {from} and {to} are replaced with the paths")
+	flag.BoolVar(&opts.ignoreOnRenameErrors, "ignore-on-rename-errors", false, "Continue even if the -on-rename command fails")
+	flag.StringVar(&opts.renameScript, "rename-script", "", "Write renames as a shell script of mv commands to the `file` instead of renaming")
+	flag.BoolVar(&opts.renameOnly, "rename-only", false, "Only rename files and dirs without replacing text")
+	flag.BoolVar(&opts.collisionSuffix, "collision-suffix", false, "Append a numeric suffix like member-2.go to a renamed file or dir whose destination already exists")
+	flag.BoolVar(&opts.checkReferences, "check-references", false, "Warn about files still referring to the old names of renamed files and dirs in any form after all changes")
+	flag.BoolVar(&opts.rewriteSymlinks, "rewrite-symlinks", false, "Replace words in the target paths of symlinks")
+	flag.StringVar(&opts.regionStart, "region-start", "", "Replace words only in regions after the `marker` and before the -region-end marker")
+	flag.StringVar(&opts.regionEnd, "region-end", "", "The `marker` which ends a region started by -region-start")
+	flag.BoolVar(&opts.onlyRegion, "only-region", false, "Replace words only in generated blocks between the \"// BEGIN GENERATED\" and \"// END GENERATED\" lines unless -region-start and -region-end are specified")
+	flag.BoolVar(&opts.skipFrontMatter, "skip-frontmatter", false, "Don't replace words in a leading YAML front matter block")
+	flag.BoolVar(&opts.envMode, "env-mode", false, "Don't replace words in the keys of dotenv files (.env, .env.*, *.env)")
+	flag.BoolVar(&opts.jsonValuesOnly, "json-values-only", false, "Replace words only in the string values of .json files, not in the keys")
+	flag.StringVar(&opts.htmlAttr, "html-attr", "", "Replace words only in the values of the `attribute` of the tags in HTML and XML files, e.g. class")
+	flag.StringVar(&opts.contextPattern, "context-pattern", "", "Replace words only within the matches of the regular `expression`, e.g. \"type \\w+\"")
+	flag.BoolVar(&opts.commentsOnly, "comments-only", false, "Replace words only in the comments of source files (//, /* */, # depending on the extension)")
+	flag.BoolVar(&opts.preserveAlignment, "preserve-alignment", false, "Adjust the gaps of spaces in changed lines so that aligned columns stay aligned")
+	flag.BoolVar(&opts.firstOnly, "first-only", false, "Replace only the first occurrence of each form in a file")
+	flag.BoolVar(&opts.smartCase, "smart-case", false, "Match words case-insensitively and adopt the casing of each match (lower, UPPER or Title) for the replacement")
+	flag.BoolVar(&opts.twoPass, "two-pass", false, "Replace words via placeholders so that a replaced word is never replaced again, e.g. for swaps")
+	flag.BoolVar(&opts.allowPartialWord, "allow-partial-word", false, "Match words as substrings of larger words as by default, overriding -prose given e.g. by an alias")
+	flag.StringVar(&opts.dictFile, "dict-file", "", "Use the exact `file` of \"before<TAB>after\" lines as the dictionary for both text and file names, without case forms and the arguments")
+	flag.BoolVar(&opts.literal, "literal", false, "Replace the before argument with the after argument literally in both text and file names, without case forms")
+	flag.BoolVar(&opts.regex, "regex", false, "Treat the before argument as a regular expression and the after argument as its replacement which can refer to capture groups like $1, without case forms")
+	flag.BoolVar(&opts.prose, "prose", false, "Replace only whole words delimited by spaces or punctuations, e.g. for documents")
+	flag.BoolVar(&opts.gzip, "gzip", false, "Replace words in the decompressed content of .gz files")
+	flag.BoolVar(&opts.binaryStrings, "binary-strings", false, "Replace ASCII strings in binary files as well (words must be of the same length)")
+	flag.BoolVar(&opts.renameBinary, "rename-binary", false, "Rename binary files by their names as well, while replacing words only in text files")
+	flag.IntVar(&opts.jobs, "jobs", 1, "Number of files processed in parallel")
+	flag.BoolVar(&opts.tree, "tree", false, "Print the diffs grouped under the directory tree")
+	flag.StringVar(&opts.diffDir, "diff-dir", "", "Write the before and after versions of each changed file under before/ and after/ in the `dir` for a visual diff tool")
+	flag.IntVar(&opts.maxDiffLines, "max-diff-lines", 0, "Truncate the shown diff of each file after the `number` of lines (0: unlimited)")
+	flag.IntVar(&opts.maxReplacementsPerFile, "max-replacements-per-file", 0, "Skip files which would have more replacements than the `limit` (0: unlimited)")
+	flag.BoolVar(&opts.requireAllForms, "require-all-forms", false, "Skip files which contain only some of the forms of a case of the words, e.g. snake_case but not SCREAMING_SNAKE_CASE, which may be inconsistently named, with a warning")
+	flag.BoolVar(&opts.dumpTargets, "dump-targets", false, "Print only the sorted paths of the target files and exit, where the words can be omitted")
+	flag.BoolVar(&opts.debugDetect, "debug-detect", false, "Print every scanned file with its detected content type and whether it's included or skipped, and exit, where the words can be omitted")
+	flag.BoolVar(&opts.helpForms, "help-forms", false, "Print the supported case forms with examples and exit")
+	flag.Var(&opts.formOrder, "form-order", "Case `forms` applied first in the order in text replacement, followed by the others in the default order (comma-separated, repeatable)")
+	flag.Var(&opts.formsFor, "forms-for", "Restrict text replacement in files with the extension to the case forms, e.g. `.go:upper-camel,lower-camel` (repeatable)")
+	flag.IntVar(&opts.sample, "sample", 0, "Dry run showing only the diffs of the first `count` changed files, without renaming")
+	flag.BoolVar(&opts.stripBOM, "strip-bom", false, "Remove a leading UTF-8 BOM from the target files, which is kept by default")
+	flag.BoolVar(&opts.preserveMtime, "preserve-mtime", false, "Keep the modification times of the replaced files")
+	flag.StringVar(&opts.diffAlgo, "diff-algo", "myers", "Diff `algorithm` (myers, line)")
+	flag.StringVar(&opts.colorAdd, "color-add", "green", "The `color` of added lines in diffs and new names in renames")
+	flag.StringVar(&opts.colorRemove, "color-remove", "red", "The `color` of removed lines in diffs and old names in renames")
+	flag.StringVar(&opts.logFormat, "log-format", "", "Log operational messages as structured records of the `format` (text or json) to stderr instead of printing them, keeping diffs on stdout")
+	flag.StringVar(&opts.format, "format", "text", "Output `format` (text, json, jsonl, patch). The others than text require -dry-run, and patch includes no renames")
+	flag.BoolVar(&opts.assertClean, "assert-clean", false, "Fail if any word still remains in the replaceable regions after replacement")
+	flag.IntVar(&opts.minWordLength, "min-word-length", 0, "Refuse to replace words shorter than the `length` unless -force is given")
+	flag.BoolVar(&opts.force, "force", false, "Proceed even if a safety check fails")
+	flag.BoolVar(&opts.renameWithTextDict, "rename-with-text-dict", false, "Rename files and dirs with the dictionary for text, which includes the space separated forms like \"User Profile\"")
+	flag.StringVar(&opts.fileNameForm, "filename-form", "", "Restrict file rename to the single case `form` (e.g. kebab, snake, upper-camel)")
+	flag.Usage = func() {
+		o := flag.CommandLine.Output()
+		_, name := filepath.Split(flag.CommandLine.Name())
+		_, _ = fmt.Fprintf(o, "Usage: %s <hyphenated-before-words> <hyphenated-after-words>\n\nOptions:\n", name)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if opts.helpForms {
+		return opts, nil
+	}
+	if opts.dictFile != "" {
+		if flag.NArg() != 0 {
+			return opts, errors.New("no arguments are allowed with -dict-file")
 		}
-		if beforeFile == afterFile {
-			continue
+		if opts.regex || opts.literal {
+			return opts, errors.New("-dict-file can't be used with -regex or -literal")
 		}
-
-		if !dryRun {
-			afterPath := filepath.Join(dir, afterFile)
-			if err := os.Rename(beforePath, afterPath); err != nil {
-				return err
+	}
+	if opts.literal && (opts.regex || opts.smartCase) {
+		return opts, errors.New("-literal can't be used with -regex or -smart-case")
+	}
+	// $1 of a regex template refers to a capture group, which would be expanded as a variable
+	if opts.regex && opts.expandEnv {
+		return opts, errors.New("-expand-env can't be used with -regex")
+	}
+	// The words are not needed only to dump or debug the targets or with a dictionary file
+	if flag.NArg() != 2 && !((opts.dumpTargets || opts.debugDetect || opts.dictFile != "") && flag.NArg() == 0) {
+		return opts, errors.New("required two arguments")
+	}
+	for name, patterns := range map[string]listFlag{"force-text": opts.forceText, "include": opts.include, "exclude": opts.exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return opts, fmt.Errorf("invalid pattern for -%s: %s", name, pattern)
 			}
 		}
-		fmt.Printf("%s => %s\n", filepath.Join(dir, colorize(color.FgRed, beforeFile)), filepath.Join(dir, colorize(color.FgGreen, afterFile)))
 	}
-	return nil
-}
-
+	for _, name := range opts.formOrder {
+		if _, ok := findCaseForm(name); !ok {
+			return opts, fmt.Errorf("unknown form for -form-order: %s (available: %s)", name, strings.Join(caseFormNames(), ", "))
+		}
+	}
+	if opts.fileNameForm != "" {
+		if _, ok := findCaseForm(opts.fileNameForm); !ok {
+			return opts, fmt.Errorf("unknown form for -filename-form: %s (available: %s)", opts.fileNameForm, strings.Join(caseFormNames(), ", "))
+		}
+	}
+	if _, ok := diffAlgorithms[opts.diffAlgo]; !ok {
+		return opts, fmt.Errorf("unknown diff algorithm: %s", opts.diffAlgo)
+	}
+	for name, value := range map[string]string{"color-add": opts.colorAdd, "color-remove": opts.colorRemove} {
+		if _, ok := colorNames[value]; !ok {
+			return opts, fmt.Errorf("unknown color for -%s: %s (available: %s)", name, value, strings.Join(sortedColorNames(), ", "))
+		}
+	}
+	switch opts.logFormat {
+	case "", "text", "json":
+	default:
+		return opts, fmt.Errorf("unknown log format: %s", opts.logFormat)
+	}
+	switch opts.format {
+	case "text":
+	case "json", "jsonl", "patch":
+		if !opts.dryRun {
+			return opts, fmt.Errorf("-format=%s requires -dry-run", opts.format)
+		}
+	default:
+		return opts, fmt.Errorf("unknown format: %s", opts.format)
+	}
+	if opts.allowPartialWord {
+		// The substring matching is the default, so this only overrides -prose, e.g. given by an alias,
+		// which also allows the options incompatible with -prose
+		opts.prose = false
+	}
+	if opts.maxDepth < -1 {
+		return opts, errors.New("-max-depth must be -1 or more")
+	}
+	if opts.noRecurse {
+		// The max depth is used not only for scanning but also for rewriting symlinks
+		opts.maxDepth = 0
+	}
+	if opts.contextPattern != "" {
+		if _, err := regexp.Compile(opts.contextPattern); err != nil {
+			return opts, fmt.Errorf("invalid -context-pattern: %w", err)
+		}
+	}
+	if opts.modifiedSince < 0 {
+		return opts, errors.New("-modified-since must not be negative")
+	}
+	if opts.modifiedSince > 0 {
+		opts.modifiedAfter = time.Now().Add(-opts.modifiedSince)
+	}
+	if opts.htmlAttr != "" && !htmlAttrNamePattern.MatchString(opts.htmlAttr) {
+		return opts, fmt.Errorf("invalid attribute name for -html-attr: %q", opts.htmlAttr)
+	}
+	if (opts.regionStart == "") != (opts.regionEnd == "") {
+		return opts, errors.New("-region-start and -region-end must be specified together")
+	}
+	if opts.onlyRegion && opts.regionStart == "" {
+		opts.regionStart = defaultRegionStart
+		opts.regionEnd = defaultRegionEnd
+	}
+	if opts.archive != "" {
+		if ext := filepath.Ext(opts.archive); ext != ".zip" && ext != ".tar" {
+			return opts, fmt.Errorf("unsupported archive: %s", opts.archive)
+		}
+		if opts.filesFrom != "" || opts.watch || opts.check || opts.format != "text" || opts.sample > 0 {
+			return opts, errors.New("-archive can't be used with -files-from, -watch, -check, -format=json, -format=jsonl, -format=patch or -sample")
+		}
+	}
+	if opts.check {
+		if opts.format != "text" || opts.watch {
+			return opts, errors.New("-check can't be used with -format=json, -format=jsonl, -format=patch or -watch")
+		}
+		opts.dryRun = true
+	}
+	if opts.outcomes {
+		if opts.format != "text" || opts.watch || opts.check {
+			return opts, errors.New("-outcomes can't be used with -format=json, -format=jsonl, -format=patch, -watch or -check")
+		}
+		opts.dryRun = true
+	}
+	if opts.watch && (opts.format != "text" || opts.sample > 0 || opts.renameOnly) {
+		return opts, errors.New("-watch can't be used with -format=json, -format=jsonl, -format=patch, -sample or -rename-only")
+	}
+	if opts.checkReferences && opts.dryRun {
+		return opts, errors.New("-check-references can't be used with -dry-run")
+	}
+	if opts.confirmRenames && (opts.dryRun || opts.renameScript != "") {
+		return opts, errors.New("-confirm-renames can't be used with -dry-run or -rename-script")
+	}
+	if opts.twoPass && (opts.prose || opts.firstOnly || opts.smartCase) {
+		return opts, errors.New("-two-pass can't be used with -prose, -first-only or -smart-case")
+	}
+	if opts.smartCase && (opts.prose || opts.firstOnly) {
+		return opts, errors.New("-smart-case can't be used with -prose or -first-only")
+	}
+	if opts.sample > 0 {
+		if opts.renameOnly {
+			return opts, errors.New("-sample can't be used with -rename-only")
+		}
+		opts.dryRun = true
+	}
+	opts.before, opts.after = flag.Arg(0), flag.Arg(1)
+	if opts.expandEnv {
+		opts.before, opts.after = os.ExpandEnv(opts.before), os.ExpandEnv(opts.after)
+	}
+	// An empty before word would match everywhere, while an empty after word deletes the before words in all forms
+	if opts.before == "" && !opts.dumpTargets && !opts.debugDetect && opts.dictFile == "" {
+		return opts, errors.New("before words must not be empty")
+	}
+	if opts.regex {
+		if _, err := regexp.Compile(opts.before); err != nil {
+			return opts, fmt.Errorf("invalid -regex pattern: %w", err)
+		}
+		return opts, nil
+	}
+	if opts.expandEnv && !opts.literal {
+		args := []string{opts.before}
+		// An empty after word deletes the before words as well as without -expand-env
+		if opts.after != "" {
+			args = append(args, opts.after)
+		}
+		for _, arg := range args {
+			if !hyphenatedWordsPattern.MatchString(arg) {
+				return opts, fmt.Errorf("expanded argument is not hyphenated words: %q", arg)
+			}
+		}
+	}
+	// A before word of only separators like "-" is empty in the forms, which would match everywhere as well
+	if opts.before != "" && !opts.literal {
+		for _, d := range []dict{generateDictForText(opts.before, opts.after), generateDictForFileName(opts.before, opts.after)} {
+			for _, it := range d.items {
+				if it.before == "" {
+					return opts, fmt.Errorf("before words must not be empty in the %s form: %q", it.form, opts.before)
+				}
+			}
+		}
+	}
+	// A file name would be only its extension like ".txt"
+	if opts.exactFileName && opts.after == "" && opts.dictFile == "" {
+		return opts, errors.New("-exact-filename can't be used with an empty after word")
+	}
+	return opts, nil
+}
+
+// hyphenatedWordsPattern matches words joined with a hyphen, e.g. "user-profile".
+var hyphenatedWordsPattern = regexp.MustCompile(`^[\p{L}\p{N}_]+(-[\p{L}\p{N}_]+)*$`)
+
+var ignoredDirs = []string{".idea", ".git", "node_modules", "build", "public"}
+
+// targetFile is a file to be processed with its metadata.
+type targetFile struct {
+	baseDir string // target dir which the file is found under
+	path    string
+	info    os.FileInfo
+	forms   []string // case forms restricted by the nearest .replaceword.forms, or nil for all forms
+	binary  bool     // binary file found only to be renamed with -rename-binary
+	skipped string   // reason why the file is skipped, which is found only to be reported with -outcomes
+}
+
+// textFiles returns the files whose contents are to be replaced, excluding the binary files only to be renamed.
+func textFiles(files []targetFile) []targetFile {
+	var found []targetFile
+	for _, file := range unskippedFiles(files) {
+		if !file.binary {
+			found = append(found, file)
+		}
+	}
+	return found
+}
+
+// unskippedFiles returns the files to be processed, excluding the skipped files only to be reported.
+func unskippedFiles(files []targetFile) []targetFile {
+	var found []targetFile
+	for _, file := range files {
+		if file.skipped == "" {
+			found = append(found, file)
+		}
+	}
+	return found
+}
+
+// formsFileName is the name of the file which restricts the case forms applied to the files in its dir and subtree.
+const formsFileName = ".replaceword.forms"
+
+// readFormsFile reads the case forms listed in the forms file of the dir, separated by lines or commas.
+// Lines starting with "#" are comments. It returns nil if the dir has no forms file.
+func readFormsFile(dir string) ([]string, error) {
+	path := filepath.Join(dir, formsFileName)
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	forms := []string{}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, name := range strings.Split(line, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := findCaseForm(name); !ok {
+				return nil, fmt.Errorf("%s: unknown form: %s (available: %s)", path, name, strings.Join(caseFormNames(), ", "))
+			}
+			forms = append(forms, name)
+		}
+	}
+	return forms, nil
+}
+
+// expandTargetDirs expands the target dir as a glob pattern if it contains any meta characters.
+func expandTargetDirs(dir string) ([]string, error) {
+	if !strings.ContainsAny(dir, "*?[") {
+		return []string{dir}, nil
+	}
+
+	matches, err := filepath.Glob(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for -dir: %s", dir)
+	}
+	var dirs []string
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && info.IsDir() {
+			dirs = append(dirs, match)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, fmt.Errorf("no dirs match -dir: %s", dir)
+	}
+	return dirs, nil
+}
+
+// commonDir returns the deepest dir which contains all the dirs, or "" if there are no dirs.
+func commonDir(dirs []string) string {
+	if len(dirs) == 0 {
+		return ""
+	}
+	common := filepath.Clean(dirs[0])
+	for _, dir := range dirs[1:] {
+		dir = filepath.Clean(dir)
+		for common != dir && !strings.HasPrefix(dir, strings.TrimSuffix(common, string(filepath.Separator))+string(filepath.Separator)) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				// Relative dirs without a common ancestor are in the current dir
+				return "."
+			}
+			common = parent
+		}
+	}
+	return common
+}
+
+func filesUnder(baseDir string, files []targetFile) []targetFile {
+	var found []targetFile
+	for _, file := range files {
+		if file.baseDir == baseDir {
+			found = append(found, file)
+		}
+	}
+	return found
+}
+
+// findTargetFiles finds text files under the dir. The depth is that of the dir from the target dir.
+func findTargetFiles(dir string, depth int, opts options) ([]targetFile, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	forms, err := readFormsFile(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []targetFile
+	// A skipped file is printed with -debug-detect and kept only to be reported with -outcomes
+	skip := func(path string, bs []byte, reason string) {
+		printDetection(path, bs, "skipped: "+reason, opts)
+		if opts.outcomes {
+			targets = append(targets, targetFile{path: path, skipped: reason})
+		}
+	}
+loop:
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+
+		if matchAny(opts.exclude, path) {
+			if !isDir(file, path) {
+				skip(path, nil, "excluded")
+			}
+			continue
+		}
+
+		if isDir(file, path) {
+			// Ignore dirs beyond the max depth
+			if opts.maxDepth >= 0 && depth >= opts.maxDepth {
+				continue
+			}
+
+			// Ignore specified dirs
+			for _, ignore := range ignoredDirs {
+				if file.Name() == ignore {
+					continue loop
+				}
+			}
+
+			foundInChild, err := findTargetFiles(path, depth+1, opts)
+			if err != nil {
+				if opts.strict || !errors.Is(err, fs.ErrPermission) {
+					return nil, err
+				}
+				printWarn("skipped unreadable dir: %s", err)
+				continue
+			}
+
+			// The forms of a nearer dir take precedence
+			for i := range foundInChild {
+				if foundInChild[i].forms == nil {
+					foundInChild[i].forms = forms
+				}
+			}
+			targets = append(targets, foundInChild...)
+			continue
+		}
+
+		if file.Name() == formsFileName {
+			skip(path, nil, "forms file")
+			continue
+		}
+
+		if !opts.included(path) {
+			skip(path, nil, "not included")
+			continue
+		}
+
+		// A dangling symlink can't be stat'ed as well as an unreadable file
+		info, err := fileInfo(file, path)
+		if err != nil {
+			if opts.strict {
+				return nil, err
+			}
+			printWarn("skipped unreadable file: %s", err)
+			skip(path, nil, "unreadable")
+			continue
+		}
+		if !opts.modifiedAfter.IsZero() && info.ModTime().Before(opts.modifiedAfter) {
+			skip(path, nil, "not modified recently")
+			continue
+		}
+
+		// Ignore binary files unless they are forced to be text or their strings are to be replaced
+		sniff := !opts.binaryStrings && !forcedText(path, opts)
+		var bs []byte
+		if sniff || opts.strictUTF8 || opts.debugDetect {
+			bs, err = readContent(path, opts)
+			if err != nil {
+				if opts.strict {
+					return nil, err
+				}
+				printWarn("skipped unreadable file: %s", err)
+				skip(path, nil, "unreadable")
+				continue
+			}
+			if sniff && !isText(path, bs, opts) {
+				if opts.renameBinary {
+					printDetection(path, bs, "included: binary only to be renamed", opts)
+					targets = append(targets, targetFile{path: path, info: info, forms: forms, binary: true})
+				} else {
+					skip(path, bs, "binary")
+				}
+				continue
+			}
+			// Invalid UTF-8 can be corrupted when the content is handled as a string
+			if opts.strictUTF8 && (sniff || isText(path, bs, opts)) && !utf8.Valid(bs) {
+				if opts.strict {
+					return nil, fmt.Errorf("%s: invalid UTF-8", path)
+				}
+				printWarn("skipped invalid UTF-8 file: %s", path)
+				skip(path, bs, "invalid UTF-8")
+				continue
+			}
+		}
+
+		if sniff {
+			printDetection(path, bs, "included", opts)
+		} else {
+			printDetection(path, bs, "included: forced", opts)
+		}
+		targets = append(targets, targetFile{path: path, info: info, forms: forms})
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].path < targets[j].path
+	})
+	return targets, nil
+}
+
+// printOutcomes prints the outcome of every scanned file in -outcomes mode.
+func printOutcomes(files []targetFile, results []fileResult, skipped []fileResult) {
+	outcomes := map[string]string{}
+	for _, file := range files {
+		switch {
+		case file.skipped != "":
+			outcomes[file.path] = "skipped: " + file.skipped
+		case file.binary:
+			outcomes[file.path] = "rename only: binary"
+		default:
+			outcomes[file.path] = "no match"
+		}
+	}
+	for _, result := range skipped {
+		outcomes[result.path] = "skipped: " + result.skipped
+	}
+	for _, result := range results {
+		outcomes[result.path] = fmt.Sprintf("would change (%d)", result.count)
+	}
+
+	var paths []string
+	for path := range outcomes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	fmt.Fprintln(messages, colorize(color.FgCyan, ">> Outcomes"))
+	for _, path := range paths {
+		fmt.Fprintf(messages, "%s: %s\n", path, outcomes[path])
+	}
+}
+
+// printDetection prints the scanned file with its detected content type and the decision in -debug-detect mode.
+// The content type is "-" if the content isn't read.
+func printDetection(path string, bs []byte, decision string, opts options) {
+	if !opts.debugDetect {
+		return
+	}
+	contentType := "-"
+	if bs != nil {
+		contentType = http.DetectContentType(bs)
+	}
+	fmt.Printf("%s\t%s\t%s\n", path, contentType, decision)
+}
+
+// fileInfo returns the metadata of the file, which is that of the linked file for a symlink.
+func fileInfo(file os.DirEntry, path string) (os.FileInfo, error) {
+	if file.Type()&os.ModeSymlink != 0 {
+		return os.Stat(path)
+	}
+	return file.Info()
+}
+
+// readTargetFiles reads the target files from the list file, whose paths are used as they are.
+func readTargetFiles(listPath string, opts options) ([]targetFile, error) {
+	r := os.Stdin
+	if listPath != "-" {
+		f, err := os.Open(listPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var targets []targetFile
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		path := strings.TrimSpace(scanner.Text())
+		if path == "" {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("not a file: %s", path)
+		}
+
+		if opts.detectBinary && !opts.binaryStrings {
+			bs, err := readContent(path, opts)
+			if err != nil {
+				return nil, err
+			}
+			if !isText(path, bs, opts) {
+				if opts.renameBinary {
+					targets = append(targets, targetFile{path: filepath.Clean(path), info: info, binary: true})
+				} else if opts.outcomes {
+					targets = append(targets, targetFile{path: filepath.Clean(path), skipped: "binary"})
+				}
+				continue
+			}
+		}
+
+		targets = append(targets, targetFile{path: filepath.Clean(path), info: info})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].path < targets[j].path
+	})
+	return targets, nil
+}
+
+func isText(path string, bs []byte, opts options) bool {
+	return forcedText(path, opts) || strings.HasPrefix(http.DetectContentType(bs), "text/")
+}
+
+// forcedText reports whether the file is treated as text by -force-text or -text-extensions without sniffing.
+func forcedText(path string, opts options) bool {
+	if matchAny(opts.forceText, path) {
+		return true
+	}
+	ext := filepath.Ext(path)
+	for _, textExt := range opts.textExtensions {
+		if ext != "" && strings.EqualFold(ext, "."+strings.TrimPrefix(textExt, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether the path or its base name matches any of the glob patterns.
+func matchAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(file os.DirEntry, path string) bool {
+	fileInfo, err := file.Info()
+	if err != nil {
+		return false
+	}
+
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		linkPath, err := os.Readlink(path)
+		if err != nil {
+			return false
+		}
+
+		targetInfo, err := os.Stat(linkPath)
+		if err != nil {
+			return false
+		}
+
+		return targetInfo.IsDir()
+	}
+
+	return file.IsDir()
+}
+
+type dict struct {
+	items []dictItem
+}
+
+type dictItem struct {
+	form   string
+	before string
+	after  string
+}
+
+func (d dict) String() string {
+	return d.describe(false)
+}
+
+// describe returns the items line by line followed by the warning of colliding forms if any.
+// Each item is labeled with its form if labeled is true.
+func (d dict) describe(labeled bool) string {
+	var its []string
+	// The forms of each item are grouped to name the forms which collide
+	var keys []string
+	forms := map[string][]string{}
+	for _, it := range d.items {
+		s := it.String()
+		if _, ok := forms[s]; !ok {
+			keys = append(keys, s)
+		}
+		forms[s] = append(forms[s], it.form)
+		if labeled {
+			s += fmt.Sprintf(" (%s)", it.form)
+		}
+		its = append(its, s)
+	}
+	var collisions []string
+	for _, key := range keys {
+		if len(forms[key]) > 1 {
+			collisions = append(collisions, fmt.Sprintf("  %s collide: %s", joinWords(forms[key]), key))
+		}
+	}
+	if len(collisions) > 0 {
+		its = append(its, colorize(color.FgYellow, "WARN: dictionary is ambiguous"))
+		for _, collision := range collisions {
+			its = append(its, colorize(color.FgYellow, collision))
+		}
+		its = append(its, colorize(color.FgYellow, "HINT: It may cause unexpected result. You'd better add another word at least."))
+	}
+	return strings.Join(its, "\n")
+}
+
+// trimmedIf returns a dictionary without the items whose before words are identical to those of the preceding items
+// if trim is true, or the dictionary as is. The first of the forms identical to the raw input is kept,
+// because the raw word written as is in the text is still to be replaced.
+func (d dict) trimmedIf(trim bool) dict {
+	if !trim {
+		return d
+	}
+	var items []dictItem
+	seen := map[string]bool{}
+	for _, it := range d.items {
+		if seen[it.before] {
+			continue
+		}
+		seen[it.before] = true
+		items = append(items, it)
+	}
+	return dict{items: items}
+}
+
+// replaceFunc post-processes the after word of each item before a content or a file name is replaced,
+// e.g. to log the replacements or to skip one by returning the before word. The CLI leaves it nil.
+var replaceFunc func(form, before, after string) string
+
+// postProcessed returns a dictionary whose after words are post-processed by replaceFunc if it's set,
+// or the dictionary as is.
+func (d dict) postProcessed() dict {
+	if replaceFunc == nil {
+		return d
+	}
+	items := make([]dictItem, len(d.items))
+	for i, it := range d.items {
+		it.after = replaceFunc(it.form, it.before, it.after)
+		items[i] = it
+	}
+	return dict{items: items}
+}
+
+// shortestWord returns the shortest word to be replaced in the dictionaries.
+func shortestWord(dicts ...dict) (string, bool) {
+	var shortest string
+	var found bool
+	for _, d := range dicts {
+		for _, it := range d.items {
+			if !found || utf8.RuneCountInString(it.before) < utf8.RuneCountInString(shortest) {
+				shortest, found = it.before, true
+			}
+		}
+	}
+	return shortest, found
+}
+
+// ordered returns a dictionary whose items of the forms come first in the order, followed by the others as they are.
+func (d dict) ordered(forms []string) dict {
+	var items []dictItem
+	for _, form := range forms {
+		for _, it := range d.items {
+			if it.form == form {
+				items = append(items, it)
+			}
+		}
+	}
+	for _, it := range d.items {
+		var listed bool
+		for _, form := range forms {
+			if it.form == form {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			items = append(items, it)
+		}
+	}
+	return dict{items: items}
+}
+
+// joinWords joins the words like "a, b and c".
+func joinWords(words []string) string {
+	if len(words) < 2 {
+		return strings.Join(words, "")
+	}
+	return strings.Join(words[:len(words)-1], ", ") + " and " + words[len(words)-1]
+}
+
+// only returns a dictionary which consists of the items of the specified case forms.
+func (d dict) only(forms []string) dict {
+	var items []dictItem
+	for _, it := range d.items {
+		for _, form := range forms {
+			if it.form == form {
+				items = append(items, it)
+				break
+			}
+		}
+	}
+	return dict{items: items}
+}
+
+// formSeparators are the separators between words of the case forms which have them.
+var formSeparators = map[string]string{
+	"screaming-snake": "_",
+	"snake":           "_",
+	"screaming-kebab": "-",
+	"kebab":           "-",
+}
+
+// withSeparator returns a dictionary whose after words are joined by the separator in all the separated forms.
+func (d dict) withSeparator(sep string) dict {
+	items := make([]dictItem, len(d.items))
+	for i, it := range d.items {
+		if formSep, ok := formSeparators[it.form]; ok {
+			it.after = strings.ReplaceAll(it.after, formSep, sep)
+		}
+		items[i] = it
+	}
+	return dict{items: items}
+}
+
+func (di dictItem) String() string {
+	return fmt.Sprintf(`"%s" => "%s"`, di.before, di.after)
+}
+
+// dictItemJSON is the JSON representation of dictItem.
+type dictItemJSON struct {
+	Form   string `json:"form"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+func (d dict) MarshalJSON() ([]byte, error) {
+	items := d.items
+	if items == nil {
+		items = []dictItem{}
+	}
+	return json.Marshal(items)
+}
+
+func (d *dict) UnmarshalJSON(bs []byte) error {
+	return json.Unmarshal(bs, &d.items)
+}
+
+func (di dictItem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dictItemJSON{Form: di.form, Before: di.before, After: di.after})
+}
+
+func (di *dictItem) UnmarshalJSON(bs []byte) error {
+	var v dictItemJSON
+	if err := json.Unmarshal(bs, &v); err != nil {
+		return err
+	}
+	*di = dictItem{form: v.Form, before: v.Before, after: v.After}
+	return nil
+}
+
+func writeDictionaries(path string, textDict dict, fileNameDict dict) error {
+	bs, err := json.MarshalIndent(map[string]dict{
+		"text":     textDict,
+		"fileName": fileNameDict,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(bs, '\n'), 0644)
+}
+
+func generateDictForText(before string, after string) dict {
+	return dict{
+		items: []dictItem{
+			{form: "upper-camel", before: upperCamelCase(before), after: upperCamelCase(after)},                                         // UpperCamelCase
+			{form: "lower-camel", before: lowerCamelCase(before), after: lowerCamelCase(after)},                                         // lowerCamelCase
+			{form: "screaming-snake", before: screamingSnakeCase(before), after: screamingSnakeCase(after)},                             // SCREAMING_SNAKE_CASE
+			{form: "snake", before: snakeCase(before), after: snakeCase(after)},                                                         // snake_case
+			{form: "screaming-kebab", before: screamingKebabCase(before), after: screamingKebabCase(after)},                             // SCREAMING-KEBAB-CASE
+			{form: "kebab", before: kebabCase(before), after: kebabCase(after)},                                                         // kebab-case
+			{form: "upper-flat", before: noSign(screamingKebabCase(before)), after: noSign(screamingKebabCase(after))},                  // UPPERCASE
+			{form: "flat", before: noSign(kebabCase(before)), after: noSign(kebabCase(after))},                                          // flatcase
+			{form: "upper-space", before: upperSpaceSeparated(before), after: upperSpaceSeparated(after)},                               // Upper Space Separated
+			{form: "capitalized-space", before: capitalize(lowerSpaceSeparated(before)), after: capitalize(lowerSpaceSeparated(after))}, // Lower space separated
+			{form: "lower-space", before: lowerSpaceSeparated(before), after: lowerSpaceSeparated(after)},                               // lower space separated
+		},
+	}
+}
+
+func generateDictForFileName(before string, after string) dict {
+	return dict{
+		items: []dictItem{
+			{form: "upper-camel", before: upperCamelCase(before), after: upperCamelCase(after)},                        // UpperCamelCase
+			{form: "lower-camel", before: lowerCamelCase(before), after: lowerCamelCase(after)},                        // lowerCamelCase
+			{form: "screaming-snake", before: screamingSnakeCase(before), after: screamingSnakeCase(after)},            // SCREAMING_SNAKE_CASE
+			{form: "snake", before: snakeCase(before), after: snakeCase(after)},                                        // snake_case
+			{form: "screaming-kebab", before: screamingKebabCase(before), after: screamingKebabCase(after)},            // SCREAMING-KEBAB-CASE
+			{form: "kebab", before: kebabCase(before), after: kebabCase(after)},                                        // kebab-case
+			{form: "upper-flat", before: noSign(screamingKebabCase(before)), after: noSign(screamingKebabCase(after))}, // UPPERCASE
+			{form: "flat", before: noSign(kebabCase(before)), after: noSign(kebabCase(after))},                         // flatcase
+		},
+	}
+}
+
+// generateDictForRegex generates a dictionary which consists of only the regular expression and its replacement
+// template for -regex, without any case forms.
+func generateDictForRegex(before string, after string) dict {
+	return dict{
+		items: []dictItem{
+			{form: "regex", before: before, after: after},
+		},
+	}
+}
+
+// generateDictForLiteral generates a dictionary which consists of only the arguments as they are.
+func generateDictForLiteral(before string, after string) dict {
+	return dict{
+		items: []dictItem{
+			{form: "literal", before: before, after: after},
+		},
+	}
+}
+
+// readDictFile reads a dictionary of the exact words from "before<TAB>after" lines, where empty lines and comments are ignored.
+func readDictFile(path string) (dict, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return dict{}, err
+	}
+	var items []dictItem
+	for i, line := range strings.Split(string(bs), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		before, after, ok := strings.Cut(line, "\t")
+		if !ok || before == "" {
+			return dict{}, fmt.Errorf("%s:%d: expected \"before<TAB>after\": %q", path, i+1, line)
+		}
+		items = append(items, dictItem{form: "dict-file", before: before, after: after})
+	}
+	if len(items) == 0 {
+		return dict{}, fmt.Errorf("%s: no words", path)
+	}
+	return dict{items: items}, nil
+}
+
+// generateDictForForm generates a dictionary which consists of only the specified case form.
+func generateDictForForm(before string, after string, name string) dict {
+	form, _ := findCaseForm(name)
+	return dict{
+		items: []dictItem{
+			{form: form.name, before: form.convert(before), after: form.convert(after)},
+		},
+	}
+}
+
+// printCaseForms prints each supported case form with the example words converted.
+func printCaseForms(example string) {
+	width := 0
+	for _, form := range caseForms {
+		if len(form.name) > width {
+			width = len(form.name)
+		}
+	}
+	for _, form := range caseForms {
+		fmt.Printf("%-*s  %s\n", width+1, form.name+":", form.convert(example))
+	}
+}
+
+type caseForm struct {
+	name    string
+	convert func(string) string
+}
+
+var caseForms = []caseForm{
+	{name: "upper-camel", convert: upperCamelCase},
+	{name: "lower-camel", convert: lowerCamelCase},
+	{name: "screaming-snake", convert: screamingSnakeCase},
+	{name: "snake", convert: snakeCase},
+	{name: "screaming-kebab", convert: screamingKebabCase},
+	{name: "kebab", convert: kebabCase},
+	{name: "upper-flat", convert: func(str string) string { return noSign(screamingKebabCase(str)) }},
+	{name: "flat", convert: func(str string) string { return noSign(kebabCase(str)) }},
+	{name: "upper-space", convert: upperSpaceSeparated},
+	{name: "capitalized-space", convert: func(str string) string { return capitalize(lowerSpaceSeparated(str)) }},
+	{name: "lower-space", convert: lowerSpaceSeparated},
+}
+
+func findCaseForm(name string) (caseForm, bool) {
+	for _, form := range caseForms {
+		if form.name == name {
+			return form, true
+		}
+	}
+	return caseForm{}, false
+}
+
+func caseFormNames() []string {
+	var names []string
+	for _, form := range caseForms {
+		names = append(names, form.name)
+	}
+	return names
+}
+
+func upperCamelCase(str string) string {
+	var words []string
+	for _, w := range strings.Split(str, "-") {
+		words = append(words, capitalize(w))
+	}
+	return strings.Join(words, "")
+}
+
+func lowerCamelCase(str string) string {
+	return decapitalize(upperCamelCase(str))
+}
+
+func screamingSnakeCase(str string) string {
+	return strings.ToUpper(regexp.MustCompile(`-`).ReplaceAllString(str, "_"))
+}
+
+func snakeCase(str string) string {
+	return strings.ToLower(regexp.MustCompile(`-`).ReplaceAllString(str, "_"))
+}
+
+func screamingKebabCase(str string) string {
+	return strings.ToUpper(str)
+}
+
+func kebabCase(str string) string {
+	return strings.ToLower(str)
+}
+
+// noSign removes the hyphens between the words, e.g. "user-profile" to "userprofile".
+// Only hyphens separate words in the arguments, so underscores are kept as a part of a word as in the other forms,
+// e.g. "user__profile" stays as is for file names with double underscores as segment markers.
+func noSign(str string) string {
+	return strings.ReplaceAll(str, "-", "")
+}
+
+func upperSpaceSeparated(str string) string {
+	var words []string
+	for _, w := range strings.Split(str, "-") {
+		words = append(words, capitalize(w))
+	}
+	return strings.Join(words, " ")
+}
+
+func lowerSpaceSeparated(str string) string {
+	return strings.ReplaceAll(str, "-", " ")
+}
+
+func capitalize(str string) string {
+	for i, v := range str {
+		return string(unicode.ToUpper(v)) + str[i+utf8.RuneLen(v):]
+	}
+	return ""
+}
+
+func decapitalize(str string) string {
+	for i, v := range str {
+		return string(unicode.ToLower(v)) + str[i+utf8.RuneLen(v):]
+	}
+	return ""
+}
+
+// stdin is shared by all prompts so that no input buffered by one prompt is lost for the next.
+var stdin = bufio.NewReader(os.Stdin)
+
+// confirm prints the message to out and reads a line from in, and returns true only if it's "y" or "Y".
+func confirm(in io.Reader, out io.Writer, msg string) bool {
+	fmt.Fprint(out, colorize(color.FgYellow, "%s [y/N]: ", msg))
+	reader, ok := in.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(in)
+	}
+	line, _ := reader.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(line)) == "y"
+}
+
+// confirmationInput returns the input of the confirmation with the function to close it,
+// which is the terminal if stdin is read by -files-from.
+func confirmationInput(opts options) (io.Reader, func(), error) {
+	if opts.filesFrom != "-" {
+		return stdin, func() {}, nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return nil, nil, errors.New("can't confirm because stdin is read by -files-from (use -dry-run to see the diffs)")
+	}
+	return bufio.NewReader(tty), func() { _ = tty.Close() }, nil
+}
+
+// renameConfirmer confirms each rename in -confirm-renames mode, remembering "all" and "quit" across the base dirs.
+type renameConfirmer struct {
+	in   io.Reader
+	out  io.Writer
+	all  bool
+	quit bool
+}
+
+// confirm asks whether to rename the path and reports the answer, where an unknown answer is asked again.
+func (c *renameConfirmer) confirm(beforePath string, afterPath string) bool {
+	if c.all || c.quit {
+		return c.all
+	}
+	reader, ok := c.in.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(c.in)
+		c.in = reader
+	}
+	for {
+		fmt.Fprint(c.out, colorize(color.FgYellow, "Rename %s => %s? [y/n/a/q]: ", beforePath, afterPath))
+		line, err := reader.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		case "a", "all":
+			c.all = true
+			return true
+		case "q", "quit":
+			c.quit = true
+			return false
+		}
+		// No more answers can be read
+		if err != nil {
+			c.quit = true
+			return false
+		}
+	}
+}
+
+// estimateImpact counts the files to be changed, the replacements in them and the renames in memory before the run.
+func estimateImpact(baseDirs []string, files []targetFile, textDict dict, fileNameDict dict, opts options) (int, int, int) {
+	var changedFiles, replacements int
+	if !opts.renameOnly {
+		for _, file := range files {
+			bs, err := readContent(file.path, opts)
+			if err != nil || !isText(file.path, bs, opts) {
+				continue
+			}
+			d := textDict
+			if forms, ok := opts.formsFor[filepath.Ext(file.path)]; ok {
+				d = d.only(forms)
+			}
+			if file.forms != nil {
+				d = d.only(file.forms)
+			}
+			_, body := splitBOM(string(bs))
+			after, count := replaceContent(file.path, body, d, opts)
+			if after != body {
+				changedFiles++
+				replacements += count
+			}
+		}
+	}
+
+	var renames int
+	for _, baseDir := range baseDirs {
+		found := map[string]bool{}
+		for _, file := range filesUnder(baseDir, files) {
+			for _, path := range expandAncestorDirs(baseDir, file.path) {
+				if found[path] {
+					continue
+				}
+				found[path] = true
+				if name := filepath.Base(path); replaceFileName(name, fileNameDict, opts) != name {
+					renames++
+				}
+			}
+		}
+	}
+	return changedFiles, replacements, renames
+}
+
+// replaceText replaces words in the files and returns the results of the changed files and the skipped ones.
+func replaceText(files []targetFile, dict dict, opts options) ([]fileResult, []fileResult, error) {
+	var changed, skipped []fileResult
+	// Shown results are kept for a tree view which can be printed only after all files are processed.
+	var shown []fileResult
+	var unclean int
+	// Errors are collected instead of aborting with -collect-errors
+	var failures []error
+	fail := func(err error) error {
+		if !opts.collectErrors {
+			return err
+		}
+		failures = append(failures, err)
+		return nil
+	}
+	emit := func(result fileResult) {
+		if result.remaining > 0 {
+			unclean++
+		}
+		if result.skipped != "" {
+			skipped = append(skipped, result)
+		}
+		if result.output == "" {
+			return
+		}
+		changed = append(changed, result)
+		if opts.format == "jsonl" {
+			printJSONLine(fileReport{Path: result.path, Diff: result.diff})
+		}
+		if opts.format == "patch" {
+			fmt.Print(result.diff)
+		}
+		logInfo("replace", "path", result.path, "replacements", result.count)
+		if opts.sample > 0 && len(changed) > opts.sample {
+			return
+		}
+		shown = append(shown, result)
+		if !opts.tree {
+			fmt.Fprintln(output, result.output)
+		}
+	}
+
+	if opts.jobs <= 1 {
+		for _, file := range files {
+			result, err := replaceFile(file, dict, opts)
+			if err != nil {
+				if err := fail(err); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			emit(result)
+		}
+	} else {
+		// Each result is printed in the order of the files as soon as it and all the preceding ones are completed,
+		// so that the progress is visible in real time regardless of the order of completion.
+		type outcome struct {
+			result fileResult
+			err    error
+		}
+		outcomes := make([]chan outcome, len(files))
+		for i := range outcomes {
+			outcomes[i] = make(chan outcome, 1)
+		}
+		indexes := make(chan int)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			defer close(indexes)
+			for i := range files {
+				select {
+				case indexes <- i:
+				case <-done:
+					return
+				}
+			}
+		}()
+		for i := 0; i < opts.jobs; i++ {
+			go func() {
+				for i := range indexes {
+					result, err := replaceFile(files[i], dict, opts)
+					outcomes[i] <- outcome{result: result, err: err}
+				}
+			}()
+		}
+
+		for i := range files {
+			o := <-outcomes[i]
+			if o.err != nil {
+				if err := fail(o.err); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			emit(o.result)
+		}
+	}
+
+	if opts.tree {
+		printTree(shown)
+	}
+	if opts.sample > 0 {
+		fmt.Fprintln(messages, colorize(color.FgYellow, "%d of %d files to be changed are shown", len(shown), len(changed)))
+	}
+	if len(failures) > 0 {
+		return changed, skipped, fmt.Errorf("%d files failed\n%s", len(failures), errorSummary(failures))
+	}
+	if unclean > 0 {
+		return changed, skipped, fmt.Errorf("words still remain in %d files", unclean)
+	}
+	return changed, skipped, nil
+}
+
+// errorKinds are the kinds of errors by which the collected errors are grouped, in the order of the summary.
+var errorKinds = []string{"permission", "encoding", "I/O"}
+
+// errorKind returns the kind of the error.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrPermission):
+		return "permission"
+	case errors.As(err, new(encodingError)):
+		return "encoding"
+	}
+	return "I/O"
+}
+
+// errorSummary returns the lines of the collected errors grouped by their kinds with the counts.
+func errorSummary(errs []error) string {
+	grouped := map[string][]error{}
+	for _, err := range errs {
+		kind := errorKind(err)
+		grouped[kind] = append(grouped[kind], err)
+	}
+	var lines []string
+	for _, kind := range errorKinds {
+		if len(grouped[kind]) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %s: %d", kind, len(grouped[kind])))
+		for _, err := range grouped[kind] {
+			lines = append(lines, fmt.Sprintf("    %s", err))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fileResult is the result of replacing words in a file.
+type fileResult struct {
+	baseDir string
+	path    string
+	output  string // empty if nothing is changed
+	diff    string // uncolored unified diff
+	count   int    // number of replacements
+	skipped string // reason why the file is skipped without being changed, if any
+
+	remaining int // number of words which still remain in -assert-clean mode
+}
+
+// replaceFile replaces words in the file and returns the result including the output to be printed.
+func replaceFile(file targetFile, dict dict, opts options) (fileResult, error) {
+	path := file.path
+	bs, err := readContent(path, opts)
+	if err != nil {
+		return fileResult{}, err
+	}
+
+	if opts.binaryStrings && !isText(path, bs, opts) {
+		return replaceBinaryStrings(file, bs, dict, opts)
+	}
+
+	if forms, ok := opts.formsFor[filepath.Ext(path)]; ok {
+		dict = dict.only(forms)
+	}
+	if file.forms != nil {
+		dict = dict.only(file.forms)
+	}
+
+	beforeText := string(bs)
+	// A BOM is reattached to the replaced content unless it's to be stripped
+	bom, body := splitBOM(beforeText)
+	if opts.stripBOM {
+		bom = ""
+	}
+	afterBody, count := replaceContent(path, body, dict, opts)
+	afterText := bom + afterBody
+	if beforeText == afterText {
+		return fileResult{baseDir: file.baseDir, path: path, remaining: countRemaining(path, beforeText, dict, opts)}, nil
+	}
+	if exceedsReplacementLimit(path, count, opts) {
+		return fileResult{baseDir: file.baseDir, path: path, skipped: "too many replacements", remaining: countRemaining(path, beforeText, dict, opts)}, nil
+	}
+	if lacksForms(path, body, dict, opts) {
+		return fileResult{baseDir: file.baseDir, path: path, skipped: "only some forms", remaining: countRemaining(path, beforeText, dict, opts)}, nil
+	}
+
+	warnOverlaps(path, beforeText, afterText, dict)
+
+	if opts.diffDir != "" {
+		if err := writeDiffCopies(opts.diffDir, rootDir(file, opts), file, beforeText, afterText); err != nil {
+			return fileResult{}, err
+		}
+	}
+
+	if !opts.dryRun {
+		if err := writeFile(file, []byte(afterText), opts); err != nil {
+			return fileResult{}, err
+		}
+	}
+	diff := unifiedDiff(path, beforeText, afterText, diffAlgorithms[opts.diffAlgo])
+	if opts.format == "patch" {
+		// A patch is applied in the base dir, or in the common dir of the dirs matched by -dir, with the default -p1 of patch or git apply
+		diff = unifiedDiff(relativePath(file, opts), beforeText, afterText, diffAlgorithms[opts.diffAlgo])
+	}
+	result := fileResult{baseDir: file.baseDir, path: path, output: colorizeDiff(elideLongLines(truncateDiff(diff, opts.maxDiffLines))), diff: diff, count: count}
+
+	if opts.assertClean {
+		// The written file itself is verified to catch a failed write as well
+		if !opts.dryRun {
+			bs, err := readContent(path, opts)
+			if err != nil {
+				return fileResult{}, err
+			}
+			afterText = string(bs)
+		}
+		result.remaining = countRemaining(path, afterText, dict, opts)
+	}
+	return result, nil
+}
+
+// warnOverlaps warns about each changed line where different words of the dictionary match overlapping spans,
+// because the result of such a line depends on the order of replacement.
+func warnOverlaps(path string, beforeText string, afterText string, dict dict) {
+	afterLines := strings.Split(afterText, "\n")
+	for i, line := range strings.Split(beforeText, "\n") {
+		if i < len(afterLines) && line == afterLines[i] {
+			continue
+		}
+		if a, b, ok := findOverlap(line, dict); ok {
+			printWarn("%s:%d: replacements of %q and %q overlap", path, i+1, a, b)
+		}
+	}
+}
+
+// findOverlap returns the first pair of different words whose occurrences overlap in the line.
+func findOverlap(line string, dict dict) (string, string, bool) {
+	type span struct {
+		word       string
+		start, end int
+	}
+	var spans []span
+	for _, it := range dict.items {
+		for start := 0; ; start++ {
+			i := strings.Index(line[start:], it.before)
+			if i < 0 || it.before == "" {
+				break
+			}
+			start += i
+			spans = append(spans, span{word: it.before, start: start, end: start + len(it.before)})
+		}
+	}
+	for i, a := range spans {
+		for _, b := range spans[i+1:] {
+			if a.word != b.word && a.start < b.end && b.start < a.end {
+				return a.word, b.word, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// rootDir returns the dir which the path of the file is shown relative to,
+// i.e. the common dir of the dirs matched by -dir or the base dir of the file.
+func rootDir(file targetFile, opts options) string {
+	if opts.rootDir != "" {
+		return opts.rootDir
+	}
+	return file.baseDir
+}
+
+// relativePath returns the path of the file relative to its root dir, or the path as is if it's outside of it.
+func relativePath(file targetFile, opts options) string {
+	rel, err := filepath.Rel(rootDir(file, opts), file.path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return file.path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// writeDiffCopies writes the before and after versions of the file under the "before" and "after" dirs
+// in the diff dir, preserving the path relative to the root dir for a visual diff tool.
+func writeDiffCopies(diffDir string, root string, file targetFile, beforeText string, afterText string) error {
+	rel, err := filepath.Rel(root, file.path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		// A file outside of the root dir is placed by its absolute path so that it never escapes the diff dir
+		abs, err := filepath.Abs(file.path)
+		if err != nil {
+			return err
+		}
+		rel = strings.TrimPrefix(strings.TrimPrefix(abs, filepath.VolumeName(abs)), string(filepath.Separator))
+	}
+	for side, text := range map[string]string{"before": beforeText, "after": afterText} {
+		path := filepath.Join(diffDir, side, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countRemaining counts the words which still remain in the replaceable regions of the replaced content in -assert-clean mode.
+func countRemaining(path string, text string, dict dict, opts options) int {
+	if !opts.assertClean {
+		return 0
+	}
+
+	// A word contained in a replacement always remains, so it can't be verified
+	verifiable := dict
+	verifiable.items = nil
+	for _, it := range dict.items {
+		var contained bool
+		for _, other := range dict.items {
+			if strings.Contains(other.after, it.before) {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			verifiable.items = append(verifiable.items, it)
+		}
+	}
+
+	// Every remaining word is counted even with -first-only
+	opts.firstOnly = false
+	_, count := replaceContent(path, text, verifiable, opts)
+	if count > 0 {
+		printError("%s: %d words still remain", path, count)
+	}
+	return count
+}
+
+// replaceBinaryStrings replaces ASCII strings in the raw bytes of a binary file.
+// The dictionary must be validated by validateBinaryStrings not to shift any offset.
+func replaceBinaryStrings(file targetFile, bs []byte, dict dict, opts options) (fileResult, error) {
+	path := file.path
+	var count int
+	for _, it := range dict.items {
+		count += bytes.Count(bs, []byte(it.before))
+		bs = bytes.ReplaceAll(bs, []byte(it.before), []byte(it.after))
+	}
+	if count == 0 || exceedsReplacementLimit(path, count, opts) {
+		return fileResult{baseDir: file.baseDir, path: path}, nil
+	}
+
+	if !opts.dryRun {
+		if err := writeFile(file, bs, opts); err != nil {
+			return fileResult{}, err
+		}
+	}
+	return fileResult{baseDir: file.baseDir, path: path, output: fmt.Sprintf("%s: %d binary strings replaced", path, count), count: count}, nil
+}
+
+// exceedsReplacementLimit reports whether the number of replacements in the file exceeds the limit, warning if so.
+func exceedsReplacementLimit(path string, count int, opts options) bool {
+	if opts.maxReplacementsPerFile <= 0 || count <= opts.maxReplacementsPerFile {
+		return false
+	}
+	printWarn("%s: skipped because of too many replacements (%d > %d)", path, count, opts.maxReplacementsPerFile)
+	return true
+}
+
+// lacksForms reports whether the file contains only some of the forms of the words in -require-all-forms mode, warning if so.
+// The forms are required only in the cases present in the file, e.g. snake_case and SCREAMING_SNAKE_CASE,
+// so that a file which never uses kebab-case is not told to be inconsistent.
+func lacksForms(path string, text string, dict dict, opts options) bool {
+	if !opts.requireAllForms {
+		return false
+	}
+	found := map[string]bool{}
+	present := map[string]bool{}
+	for _, it := range dict.items {
+		if _, ok := found[it.before]; !ok {
+			single := dict
+			single.items = []dictItem{it}
+			_, count := replaceContent(path, text, single, opts)
+			found[it.before] = count > 0
+		}
+		if found[it.before] {
+			present[formCase(it.form)] = true
+		}
+	}
+	var missing []string
+	seen := map[string]bool{}
+	for _, it := range dict.items {
+		if found[it.before] || !present[formCase(it.form)] || seen[it.before] {
+			continue
+		}
+		seen[it.before] = true
+		missing = append(missing, fmt.Sprintf("%q", it.before))
+	}
+	if len(missing) == 0 {
+		return false
+	}
+	printWarn("%s: skipped because only some forms of the words are present (missing: %s)", path, strings.Join(missing, ", "))
+	return true
+}
+
+// formCase returns the case of the form without its variant, e.g. "snake" for "screaming-snake".
+func formCase(form string) string {
+	return form[strings.LastIndex(form, "-")+1:]
+}
+
+// printTree prints the results grouped under the directory tree relative to each base dir.
+func printTree(results []fileResult) {
+	var baseDir string
+	var printed map[string]bool
+	for _, result := range results {
+		if result.baseDir != baseDir || printed == nil {
+			baseDir = result.baseDir
+			printed = map[string]bool{}
+			fmt.Fprintln(output, baseDir)
+		}
+		rel, err := filepath.Rel(baseDir, result.path)
+		if err != nil {
+			rel = result.path
+		}
+		elems := strings.Split(rel, string(filepath.Separator))
+		for i := range elems[:len(elems)-1] {
+			dir := filepath.Join(elems[:i+1]...)
+			if !printed[dir] {
+				printed[dir] = true
+				fmt.Fprintf(output, "%s%s/\n", strings.Repeat("  ", i+1), elems[i])
+			}
+		}
+		indent := strings.Repeat("  ", len(elems))
+		fmt.Fprintf(output, "%s%s (%d replacements)\n", indent, elems[len(elems)-1], result.count)
+		fmt.Fprintln(output, regexp.MustCompile(`(?m)^`).ReplaceAllString(strings.TrimSuffix(result.output, "\n"), indent+"  "))
+	}
+}
+
+// validateBinaryStrings checks that each item of the dictionary replaces an ASCII string with another one of the same length.
+func validateBinaryStrings(dict dict) error {
+	for _, it := range dict.items {
+		if len(it.before) != len(it.after) {
+			return fmt.Errorf("-binary-strings requires words of the same length: %s", it)
+		}
+		for _, str := range []string{it.before, it.after} {
+			for _, r := range str {
+				if r > unicode.MaxASCII {
+					return fmt.Errorf("-binary-strings requires ASCII words: %s", it)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile writes the replaced content to the file, restoring its modification time in -preserve-mtime mode.
+func writeFile(file targetFile, bs []byte, opts options) error {
+	if err := writeContent(file.path, bs, opts); err != nil {
+		return err
+	}
+	if opts.preserveMtime {
+		return os.Chtimes(file.path, time.Now(), file.info.ModTime())
+	}
+	return nil
+}
+
+const utf8BOM = "\uFEFF"
+
+// splitBOM splits the text into a leading UTF-8 BOM if any and the rest.
+func splitBOM(text string) (string, string) {
+	if strings.HasPrefix(text, utf8BOM) {
+		return utf8BOM, text[len(utf8BOM):]
+	}
+	return "", text
+}
+
+// encodingError is an error of decoding or encoding the content of a file, e.g. a broken gzip file.
+type encodingError struct {
+	err error
+}
+
+func (e encodingError) Error() string {
+	return e.err.Error()
+}
+
+func (e encodingError) Unwrap() error {
+	return e.err
+}
+
+func isGzip(path string, opts options) bool {
+	return opts.gzip && strings.HasSuffix(path, ".gz")
+}
+
+// readContent reads the content of the file, which is decompressed for a gzip file in -gzip mode.
+func readContent(path string, opts options) ([]byte, error) {
+	if !isGzip(path, opts) {
+		return os.ReadFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, encodingError{fmt.Errorf("%s: %w", path, err)}
+	}
+	defer r.Close()
+	bs, err := io.ReadAll(r)
+	if err != nil {
+		return nil, encodingError{fmt.Errorf("%s: %w", path, err)}
+	}
+	return bs, nil
+}
+
+// writeContent writes the content to the existing file, which is compressed with the original header for a gzip file in -gzip mode.
+// The mode of the existing file is kept as is.
+func writeContent(path string, bs []byte, opts options) error {
+	if !isGzip(path, opts) {
+		return os.WriteFile(path, bs, 0)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	r, err := gzip.NewReader(f)
+	_ = f.Close()
+	if err != nil {
+		return encodingError{fmt.Errorf("%s: %w", path, err)}
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Header = r.Header
+	if _, err := w.Write(bs); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0)
+}
+
+// replaceContent replaces words in the content of a file except for the regions protected by the options.
+func replaceContent(path string, text string, dict dict, opts options) (string, int) {
+	// The dictionary is trimmed after it's restricted to the forms for the file
+	dict = dict.trimmedIf(opts.trimDict).postProcessed()
+	replace := wordReplacer(opts)
+	if opts.preserveAlignment {
+		replace = preservingAlignment(replace)
+	}
+	if opts.envMode && isEnvFile(path) {
+		replace = onlyEnvValues(replace)
+	}
+	if opts.jsonValuesOnly && filepath.Ext(path) == ".json" {
+		replace = onlyJSONValues(path, replace)
+	}
+	if opts.htmlAttr != "" && isHTMLFile(path) {
+		replace = onlyHTMLAttrs(opts.htmlAttr, replace)
+	}
+	if opts.commentsOnly {
+		replace = onlyComments(path, replace)
+	}
+	if opts.contextPattern != "" {
+		replace = onlyContexts(regexp.MustCompile(opts.contextPattern), replace)
+	}
+	if opts.skipFrontMatter {
+		replace = skippingFrontMatter(replace)
+	}
+	if opts.regionStart != "" {
+		replace = onlyRegions(opts.regionStart, opts.regionEnd, replace)
+	}
+	return replace(text, dict)
+}
+
+// replacer replaces words in the text and returns the result with the number of replacements.
+type replacer func(text string, dict dict) (string, int)
+
+// wordReplacer returns the replacer of words in a content according to the options.
+// The replacer must be created for each file because it holds the forms already replaced with -first-only.
+func wordReplacer(opts options) replacer {
+	if opts.regex {
+		return replaceRegex
+	}
+	if opts.smartCase {
+		return replaceWordsSmartCase
+	}
+	if opts.firstOnly {
+		replaced := map[string]bool{}
+		first := func(before string) bool {
+			if replaced[before] {
+				return false
+			}
+			replaced[before] = true
+			return true
+		}
+		if opts.prose {
+			return func(text string, dict dict) (string, int) {
+				return replaceWholeWordsIf(text, dict, first)
+			}
+		}
+		return func(text string, dict dict) (string, int) {
+			return replaceFirstWords(text, dict, first)
+		}
+	}
+	if opts.prose {
+		return replaceWholeWords
+	}
+	if opts.twoPass {
+		return replaceWordsTwoPass
+	}
+	return replaceWords
+}
+
+// replaceWords replaces words in the text and returns the result with the number of replacements.
+func replaceWords(text string, dict dict) (string, int) {
+	var count int
+	for _, it := range dict.items {
+		count += strings.Count(text, it.before)
+		text = strings.ReplaceAll(text, it.before, it.after)
+	}
+	return text, count
+}
+
+// replaceWordsTwoPass is the same as replaceWords except that an after word is never matched by the following items,
+// which swaps words safely. Each before word is replaced with a placeholder first, and then the placeholders with the after words.
+func replaceWordsTwoPass(text string, dict dict) (string, int) {
+	var count int
+	placeholders := make([]string, len(dict.items))
+	for i, it := range dict.items {
+		if it.before == "" {
+			continue
+		}
+		// Private use characters never appear in the words
+		placeholders[i] = fmt.Sprintf("\uE000%c\uE001", rune(0xF0000+i))
+		count += strings.Count(text, it.before)
+		text = strings.ReplaceAll(text, it.before, placeholders[i])
+	}
+	for i, it := range dict.items {
+		if placeholders[i] == "" {
+			continue
+		}
+		text = strings.ReplaceAll(text, placeholders[i], it.after)
+	}
+	return text, count
+}
+
+// replaceRegex replaces the matches of the regular expressions with the templates which can refer to
+// the capture groups like $1, and returns the result with the number of replacements.
+func replaceRegex(text string, dict dict) (string, int) {
+	var count int
+	for _, it := range dict.items {
+		pattern := regexp.MustCompile(it.before)
+		count += len(pattern.FindAllStringIndex(text, -1))
+		text = pattern.ReplaceAllString(text, it.after)
+	}
+	return text, count
+}
+
+// replaceWordsSmartCase is the same as replaceWordsIgnoringCase except that the after word of a match takes
+// the casing of the match: lower, UPPER or Title. A match equal to a before word is replaced with its after word as is.
+func replaceWordsSmartCase(text string, dict dict) (string, int) {
+	var count int
+	done := map[string]bool{}
+	for _, it := range dict.items {
+		key := strings.ToLower(it.before)
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		pattern := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(it.before))
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			count++
+			for _, exact := range dict.items {
+				if exact.before == match {
+					return exact.after
+				}
+			}
+			return applyCase(match, it.after)
+		})
+	}
+	return text, count
+}
+
+// applyCase converts the word to the casing of the sample: lower, UPPER or Title. Otherwise the word is returned as is.
+func applyCase(sample string, word string) string {
+	switch {
+	case sample == strings.ToLower(sample):
+		return strings.ToLower(word)
+	case sample == strings.ToUpper(sample):
+		return strings.ToUpper(word)
+	case sample == capitalize(strings.ToLower(sample)):
+		return capitalize(strings.ToLower(word))
+	}
+	return word
+}
+
+// replaceFirstWords is the same as replaceWords except that only the first occurrence of each word is replaced
+// if first allows it.
+func replaceFirstWords(text string, dict dict, first func(before string) bool) (string, int) {
+	var count int
+	for _, it := range dict.items {
+		if strings.Contains(text, it.before) && first(it.before) {
+			text = strings.Replace(text, it.before, it.after, 1)
+			count++
+		}
+	}
+	return text, count
+}
+
+// replaceWholeWords is the same as replaceWords except that only words delimited by non-letters are replaced.
+func replaceWholeWords(text string, dict dict) (string, int) {
+	return replaceWholeWordsIf(text, dict, func(string) bool { return true })
+}
+
+// replaceWholeWordsIf is the same as replaceWholeWords except that a whole word is replaced only if allow returns true.
+func replaceWholeWordsIf(text string, dict dict, allow func(before string) bool) (string, int) {
+	var count int
+	for _, it := range dict.items {
+		// A match is extended to the surrounding letters so that a part of a larger word can be told.
+		pattern := regexp.MustCompile(`[\p{L}\p{N}]*` + regexp.QuoteMeta(it.before) + `[\p{L}\p{N}]*`)
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if match != it.before || !allow(it.before) {
+				return match
+			}
+			count++
+			return it.after
+		})
+	}
+	return text, count
+}
+
+// isEnvFile reports whether the file is a dotenv file like ".env", ".env.local" or "app.env".
+func isEnvFile(path string) bool {
+	name := filepath.Base(path)
+	return name == ".env" || strings.HasPrefix(name, ".env.") || filepath.Ext(name) == ".env"
+}
+
+var envKeyPattern = regexp.MustCompile(`(?m)^(\s*(?:export\s+)?[A-Za-z_][A-Za-z0-9_.]*\s*=)(.*)$`)
+
+// onlyEnvValues returns a replacer which doesn't replace words in the keys of a dotenv file.
+func onlyEnvValues(replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		var count int
+		var lines []string
+		for _, line := range strings.SplitAfter(text, "\n") {
+			if m := envKeyPattern.FindStringSubmatch(line); m != nil {
+				value, n := replace(line[len(m[1]):], dict)
+				lines = append(lines, m[1]+value)
+				count += n
+				continue
+			}
+			line, n := replace(line, dict)
+			lines = append(lines, line)
+			count += n
+		}
+		return strings.Join(lines, ""), count
+	}
+}
+
+// htmlAttrNamePattern matches a name of an attribute, e.g. "class" or "data-role".
+var htmlAttrNamePattern = regexp.MustCompile(`^[A-Za-z_:][A-Za-z0-9_:.-]*$`)
+
+// isHTMLFile reports whether the file is an HTML or XML file, including templates.
+func isHTMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml", ".xml", ".svg", ".vue", ".tmpl", ".gohtml", ".jsp", ".erb":
+		return true
+	}
+	return false
+}
+
+// onlyHTMLAttrs returns a replacer which replaces words only in the values of the attribute of the tags.
+// The tags are found by the HTML tokenizer and their raw texts are written back so that the rest of the markup is kept as is.
+func onlyHTMLAttrs(name string, replace replacer) replacer {
+	attrPattern := regexp.MustCompile(`(?i)(\s` + regexp.QuoteMeta(name) + `\s*=\s*)("[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+)`)
+	return func(text string, dict dict) (string, int) {
+		var sb strings.Builder
+		var count int
+		z := html.NewTokenizer(strings.NewReader(text))
+		for {
+			tt := z.Next()
+			raw := string(z.Raw())
+			if tt == html.ErrorToken {
+				sb.WriteString(raw)
+				break
+			}
+			if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+				raw = attrPattern.ReplaceAllStringFunc(raw, func(attr string) string {
+					m := attrPattern.FindStringSubmatch(attr)
+					value := m[2]
+					quote := ""
+					if value[0] == '"' || value[0] == '\'' {
+						quote, value = value[:1], value[1:len(value)-1]
+					}
+					value, n := replace(value, dict)
+					count += n
+					return m[1] + quote + value + quote
+				})
+			}
+			sb.WriteString(raw)
+		}
+		return sb.String(), count
+	}
+}
+
+// onlyJSONValues returns a replacer which replaces words only in the string values of a JSON text, not in the keys.
+// The text is scanned as is so that its formatting is preserved.
+func onlyJSONValues(path string, replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		if !json.Valid([]byte(text)) {
+			printWarn("%s: skipped because it's not valid JSON", path)
+			return text, 0
+		}
+
+		var sb strings.Builder
+		var count int
+		for i := 0; i < len(text); i++ {
+			if text[i] != '"' {
+				sb.WriteByte(text[i])
+				continue
+			}
+
+			// Find the closing quote of the string literal
+			end := i + 1
+			for ; text[end] != '"'; end++ {
+				if text[end] == '\\' {
+					end++
+				}
+			}
+			literal := text[i+1 : end]
+
+			// A string followed by a colon is a key
+			if rest := strings.TrimLeft(text[end+1:], " \t\r\n"); !strings.HasPrefix(rest, ":") {
+				var n int
+				literal, n = replace(literal, dict)
+				count += n
+			}
+			sb.WriteString(`"` + literal + `"`)
+			i = end
+		}
+		return sb.String(), count
+	}
+}
+
+// Comment patterns also match string literals so that "//" or "#" inside a string is not taken as a comment.
+var (
+	stringLiteralPattern = `"(?:\\.|[^"\\\n])*"|'(?:\\.|[^'\\\n])*'`
+	slashCommentPattern  = regexp.MustCompile(stringLiteralPattern + "|`[^`]*`|//[^\n]*|/\\*[\\s\\S]*?\\*/")
+	blockCommentPattern  = regexp.MustCompile(stringLiteralPattern + `|/\*[\s\S]*?\*/`)
+	hashCommentPattern   = regexp.MustCompile(stringLiteralPattern + `|#[^\n]*`)
+)
+
+// onlyContexts returns a replacer which replaces words only within the matches of the context pattern.
+func onlyContexts(pattern *regexp.Regexp, replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		var count int
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			match, n := replace(match, dict)
+			count += n
+			return match
+		})
+		return text, count
+	}
+}
+
+// commentPattern returns the comment pattern for the type of the file, or nil when it's unknown.
+func commentPattern(path string) *regexp.Regexp {
+	switch filepath.Ext(path) {
+	case ".go", ".js", ".jsx", ".ts", ".tsx", ".java", ".kt", ".kts", ".groovy", ".gradle", ".scala",
+		".c", ".h", ".cc", ".cpp", ".hpp", ".cs", ".swift", ".rs", ".dart", ".php", ".scss":
+		return slashCommentPattern
+	case ".css":
+		return blockCommentPattern
+	case ".py", ".rb", ".pl", ".r", ".sh", ".bash", ".zsh", ".yaml", ".yml", ".toml", ".conf", ".properties":
+		return hashCommentPattern
+	}
+	switch filepath.Base(path) {
+	case "Makefile", "Dockerfile":
+		return hashCommentPattern
+	}
+	return nil
+}
+
+// onlyComments returns a replacer which replaces words only in the comments of a source file.
+// Nothing is replaced in a file whose comment syntax is unknown.
+func onlyComments(path string, replace replacer) replacer {
+	pattern := commentPattern(path)
+	return func(text string, dict dict) (string, int) {
+		if pattern == nil {
+			return text, 0
+		}
+		var count int
+		text = pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if strings.HasPrefix(match, `"`) || strings.HasPrefix(match, `'`) || strings.HasPrefix(match, "`") {
+				return match
+			}
+			match, n := replace(match, dict)
+			count += n
+			return match
+		})
+		return text, count
+	}
+}
+
+var frontMatterPattern = regexp.MustCompile(`(?s)\A---\r?\n.*?\r?\n---(\r?\n|\z)`)
+
+// skippingFrontMatter returns a replacer which doesn't replace words in a leading YAML front matter block.
+func skippingFrontMatter(replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		frontMatter, body := splitFrontMatter(text)
+		body, count := replace(body, dict)
+		return frontMatter + body, count
+	}
+}
+
+// alignmentGapPattern matches a gap of two or more spaces which aligns the columns of a key-value or table line.
+var alignmentGapPattern = regexp.MustCompile(`[^ ] {2,}`)
+
+// preservingAlignment returns a replacer which replaces words line by line,
+// adjusting the gaps of spaces in a changed line so that the following columns start where they did.
+func preservingAlignment(replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		lines := strings.Split(text, "\n")
+		var count int
+		for i, line := range lines {
+			replaced, n := replace(line, dict)
+			if n > 0 {
+				lines[i] = realign(line, replaced)
+				count += n
+			}
+		}
+		return strings.Join(lines, "\n"), count
+	}
+}
+
+// realign adjusts the gaps of the replaced line to the columns of the original line.
+// The line is left as is unless both have the same number of gaps. At least a space is kept in each gap.
+func realign(original string, replaced string) string {
+	originalGaps := alignmentGapPattern.FindAllStringIndex(original, -1)
+	replacedGaps := alignmentGapPattern.FindAllStringIndex(replaced, -1)
+	if len(originalGaps) == 0 || len(originalGaps) != len(replacedGaps) {
+		return replaced
+	}
+	var b strings.Builder
+	prev := 0
+	for i, gap := range replacedGaps {
+		// The matched gap starts with the last character of the preceding column.
+		b.WriteString(replaced[prev : gap[0]+1])
+		spaces := utf8.RuneCountInString(original[:originalGaps[i][1]]) - utf8.RuneCountInString(b.String())
+		if spaces < 1 {
+			spaces = 1
+		}
+		b.WriteString(strings.Repeat(" ", spaces))
+		prev = gap[1]
+	}
+	b.WriteString(replaced[prev:])
+	return b.String()
+}
+
+// The default markers of the generated blocks in -only-region mode.
+const (
+	defaultRegionStart = "// BEGIN GENERATED"
+	defaultRegionEnd   = "// END GENERATED"
+)
+
+// onlyRegions returns a replacer which replaces words only in the lines between the lines of the start and end markers.
+// A region without the end marker continues to the end of the text.
+func onlyRegions(start string, end string, replace replacer) replacer {
+	return func(text string, dict dict) (string, int) {
+		var sb strings.Builder
+		var count int
+		for {
+			// The region starts at the line next to the start marker
+			i := strings.Index(text, start)
+			if i < 0 {
+				break
+			}
+			i += len(start)
+			if nl := strings.IndexByte(text[i:], '\n'); nl >= 0 {
+				i += nl + 1
+			} else {
+				i = len(text)
+			}
+			sb.WriteString(text[:i])
+			text = text[i:]
+
+			// The region ends at the line of the end marker
+			j := strings.Index(text, end)
+			if j < 0 {
+				region, n := replace(text, dict)
+				sb.WriteString(region)
+				count += n
+				text = ""
+				break
+			}
+			j = strings.LastIndexByte(text[:j], '\n') + 1
+			region, n := replace(text[:j], dict)
+			sb.WriteString(region)
+			count += n
+			text = text[j:]
+			k := strings.Index(text, end) + len(end)
+			sb.WriteString(text[:k])
+			text = text[k:]
+		}
+		sb.WriteString(text)
+		return sb.String(), count
+	}
+}
+
+// splitFrontMatter splits the text into a leading YAML front matter block delimited by "---" lines and the rest.
+func splitFrontMatter(text string) (string, string) {
+	loc := frontMatterPattern.FindStringIndex(text)
+	if loc == nil {
+		return "", text
+	}
+	return text[:loc[1]], text[loc[1]:]
+}
+
+func unifiedDiff(path string, a string, b string, algo diffAlgorithm) string {
+	edits := algo.computeEdits(span.URIFromPath(path), a, b)
+	return fmt.Sprint(gotextdiff.ToUnified("a/"+path, "b/"+path, a, edits))
+}
+
+// truncateDiff cuts the diff after max lines and appends a marker of how many lines are omitted.
+func truncateDiff(diff string, max int) string {
+	lines := strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n")
+	if max <= 0 || len(lines) <= max {
+		return diff
+	}
+	return strings.Join(lines[:max], "") + fmt.Sprintf("... (%d more lines)\n", len(lines)-max)
+}
+
+const (
+	// longLineLength is the number of characters of a diff line over which the line is elided, e.g. in a minified file.
+	longLineLength = 500
+	// elisionContext is the number of characters shown around the changed portion of an elided line.
+	elisionContext = 40
+)
+
+// elideLongLines elides the long lines of the diff to be shown. A removed line and the added line paired with it
+// are cut down to the changed portion with the surrounding context, and other long lines to their beginning.
+func elideLongLines(diff string) string {
+	lines := strings.Split(diff, "\n")
+	inHunk := false
+	for i := 0; i < len(lines); {
+		if strings.HasPrefix(lines[i], "@@") {
+			inHunk = true
+		}
+		if !inHunk {
+			i++
+			continue
+		}
+		if !strings.HasPrefix(lines[i], "-") {
+			lines[i] = elideLine(lines[i])
+			i++
+			continue
+		}
+		// A "\ No newline at end of file" line can follow the last removed or added line
+		var removed, added []int
+		k := i
+	block:
+		for ; k < len(lines); k++ {
+			switch {
+			case strings.HasPrefix(lines[k], "-") && len(added) == 0:
+				removed = append(removed, k)
+			case strings.HasPrefix(lines[k], "+"):
+				added = append(added, k)
+			case !strings.HasPrefix(lines[k], `\`):
+				break block
+			}
+		}
+		if len(removed) == len(added) {
+			for n := range removed {
+				lines[removed[n]], lines[added[n]] = elidePair(lines[removed[n]], lines[added[n]])
+			}
+		} else {
+			for _, n := range append(removed, added...) {
+				lines[n] = elideLine(lines[n])
+			}
+		}
+		i = k
+	}
+	return strings.Join(lines, "\n")
+}
+
+// elideLine cuts down a long diff line to its beginning.
+func elideLine(line string) string {
+	rs := []rune(line)
+	if len(rs) <= longLineLength {
+		return line
+	}
+	return fmt.Sprintf("%s... (%d more characters)", string(rs[:1+2*elisionContext]), len(rs)-1-2*elisionContext)
+}
+
+// elidePair cuts down a pair of a removed and an added long line to the changed portion with the context.
+func elidePair(removed string, added string) (string, string) {
+	a, b := []rune(removed[1:]), []rune(added[1:])
+	if len(a) <= longLineLength && len(b) <= longLineLength {
+		return removed, added
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	elide := func(sign string, rs []rune) string {
+		start := prefix - elisionContext
+		if start < 0 {
+			start = 0
+		}
+		end := len(rs) - suffix + elisionContext
+		if end > len(rs) {
+			end = len(rs)
+		}
+		var sb strings.Builder
+		sb.WriteString(sign)
+		if start > 0 {
+			sb.WriteString("...")
+		}
+		sb.WriteString(string(rs[start:end]))
+		if end < len(rs) {
+			sb.WriteString("...")
+		}
+		return sb.String()
+	}
+	return elide("-", a), elide("+", b)
+}
+
+// diffAlgorithm computes the edits to turn a text into another.
+type diffAlgorithm interface {
+	computeEdits(uri span.URI, a string, b string) []gotextdiff.TextEdit
+}
+
+var diffAlgorithms = map[string]diffAlgorithm{
+	"myers": myersDiff{},
+	"line":  lineDiff{},
+}
+
+type myersDiff struct{}
+
+func (myersDiff) computeEdits(uri span.URI, a string, b string) []gotextdiff.TextEdit {
+	return myers.ComputeEdits(uri, a, b)
+}
+
+// lineDiff replaces the whole lines between the common leading and trailing lines at once,
+// which is less noisy than Myers for a text changed in many scattered places.
+type lineDiff struct{}
+
+func (lineDiff) computeEdits(uri span.URI, a string, b string) []gotextdiff.TextEdit {
+	if a == b {
+		return nil
+	}
+	linesA, linesB := strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n")
+	var head int
+	for head < len(linesA) && head < len(linesB) && linesA[head] == linesB[head] {
+		head++
+	}
+	var tail int
+	for tail < len(linesA)-head && tail < len(linesB)-head && linesA[len(linesA)-1-tail] == linesB[len(linesB)-1-tail] {
+		tail++
+	}
+	s := span.New(uri, span.NewPoint(head+1, 1, 0), span.NewPoint(len(linesA)-tail+1, 1, 0))
+	return []gotextdiff.TextEdit{{Span: s, NewText: strings.Join(linesB[head:len(linesB)-tail], "")}}
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`(?m)^@@`)
+
+func colorizeDiff(diff string) string {
+	// Only the lines before the first hunk are the file headers, because a changed line can also start with "---" or "+++",
+	// even like "--- a/" followed by the path.
+	loc := hunkHeaderPattern.FindStringIndex(diff)
+	if loc == nil {
+		return diff
+	}
+	headers, diff := diff[:loc[0]], diff[loc[0]:]
+	diff = regexp.MustCompile(`(?m)^-.*$`).ReplaceAllStringFunc(diff, func(s string) string {
+		return colorize(removeColor, s)
+	})
+	diff = regexp.MustCompile(`(?m)^\+.*$`).ReplaceAllStringFunc(diff, func(s string) string {
+		return colorize(addColor, s)
+	})
+	return headers + diff
+}
+
+// renameResult is a rename of a file or dir.
+type renameResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// renameFilesAndDirs renames the files and their ancestor dirs under the base dir and returns the renames.
+// The renames are confirmed one by one if the confirmer is given.
+func renameFilesAndDirs(baseDir string, files []targetFile, dict dict, confirmer *renameConfirmer, opts options) ([]renameResult, error) {
+	// e.g. ["aaa/bbb/ccc.txt"] -> ["aaa/bbb/ccc.txt", "aaa/bbb", "aaa"] (sorted from leaf to root)
+	var expandedPaths []string
+	found := map[string]bool{}
+	for _, file := range files {
+		for _, expanded := range expandAncestorDirs(baseDir, file.path) {
+			if !found[expanded] {
+				found[expanded] = true
+				expandedPaths = append(expandedPaths, expanded)
+			}
+		}
+	}
+	sort.Slice(expandedPaths, func(i, j int) bool {
+		return expandedPaths[i] > expandedPaths[j]
+	})
+
+	// Renames are scheduled to be run concurrently after all of them are planned with multiple jobs
+	concurrent := opts.jobs > 1 && !opts.dryRun && opts.renameScript == ""
+	var renames []renameResult
+	var failures []error
+	// Destinations planned in this run are taken as well as existing paths, which matters in a dry run
+	taken := map[string]bool{}
+	for _, beforePath := range expandedPaths {
+		dir, beforeFile := filepath.Split(beforePath)
+		dir = filepath.Dir(dir)
+
+		afterFile := replaceFileName(beforeFile, dict, opts)
+		if beforeFile == afterFile {
+			continue
+		}
+		// A name can be deleted entirely with an empty after word, which must not be a rename to the parent dir
+		if afterFile == "" || afterFile == "." || afterFile == ".." {
+			printWarn("%s: skipped renaming because the name would be %q", beforePath, afterFile)
+			continue
+		}
+
+		afterPath := filepath.Join(dir, afterFile)
+		if opts.collisionSuffix && !strings.EqualFold(beforeFile, afterFile) {
+			if resolved := resolveCollision(beforePath, afterPath, taken); resolved != afterPath {
+				printWarn("%s: %s already exists, so it's renamed to %s", beforePath, afterPath, resolved)
+				afterPath = resolved
+				afterFile = filepath.Base(resolved)
+			}
+			taken[afterPath] = true
+		}
+		if strings.EqualFold(beforeFile, afterFile) {
+			printWarn("%s: only the case is changed, which is renamed via a temporary name for case-insensitive file systems", beforePath)
+		}
+		if confirmer != nil && !confirmer.confirm(beforePath, afterPath) {
+			continue
+		}
+		if !opts.dryRun && opts.renameScript == "" && !concurrent {
+			if err := renamePath(beforePath, afterPath); err != nil {
+				if !opts.keepGoing {
+					return nil, err
+				}
+				failures = append(failures, err)
+				continue
+			}
+		}
+		renames = append(renames, renameResult{From: beforePath, To: afterPath})
+		if opts.format == "jsonl" {
+			printJSONLine(fileReport{Path: beforePath, Rename: &renameResult{From: beforePath, To: afterPath}})
+		}
+		fmt.Fprintf(messages, "%s => %s\n", filepath.Join(dir, colorize(removeColor, beforeFile)), filepath.Join(dir, colorize(addColor, afterFile)))
+		logInfo("rename", "from", beforePath, "to", afterPath)
+
+		if !concurrent {
+			if err := runRenameHookIfAny(beforePath, afterPath, opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if concurrent {
+		errs, err := renameConcurrently(renames, opts.jobs, opts.keepGoing)
+		if err != nil {
+			return nil, err
+		}
+		var succeeded []renameResult
+		for i, rename := range renames {
+			if errs[i] != nil {
+				failures = append(failures, errs[i])
+				continue
+			}
+			if err := runRenameHookIfAny(rename.From, rename.To, opts); err != nil {
+				return nil, err
+			}
+			succeeded = append(succeeded, rename)
+		}
+		renames = succeeded
+	}
+
+	if len(failures) > 0 {
+		return renames, fmt.Errorf("%d renames failed\n%s", len(failures), errorSummary(failures))
+	}
+	return renames, nil
+}
+
+// resolveCollision returns the destination path with the smallest numeric suffix from 2 like "member-2.go"
+// which neither exists nor is taken, or the path as is if it's free.
+func resolveCollision(beforePath string, afterPath string, taken map[string]bool) string {
+	free := func(path string) bool {
+		_, err := os.Lstat(path)
+		return errors.Is(err, fs.ErrNotExist) && !taken[path]
+	}
+	if free(afterPath) {
+		return afterPath
+	}
+	ext := filepath.Ext(afterPath)
+	if info, err := os.Stat(beforePath); err == nil && info.IsDir() {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(afterPath, ext)
+	for n := 2; ; n++ {
+		path := fmt.Sprintf("%s-%d%s", stem, n, ext)
+		if free(path) {
+			return path
+		}
+	}
+}
+
+// runRenameHookIfAny runs the -on-rename command after a rename unless it's a dry run or a script is written instead.
+func runRenameHookIfAny(from string, to string, opts options) error {
+	if opts.dryRun || opts.renameScript != "" || opts.onRename == "" {
+		return nil
+	}
+	if err := runRenameHook(opts.onRename, from, to); err != nil {
+		if !opts.ignoreOnRenameErrors {
+			return err
+		}
+		printWarn("%s", err)
+	}
+	return nil
+}
+
+// renameConcurrently runs the renames sorted from leaf to root with the number of jobs.
+// A dir is renamed only after all the renames under it are done, so independent subtrees are renamed concurrently.
+func renameConcurrently(renames []renameResult, jobs int, keepGoing bool) ([]error, error) {
+	index := map[string]int{}
+	for i, rename := range renames {
+		index[rename.From] = i
+	}
+	// parents[i] is the index of the nearest ancestor to be renamed, or -1
+	parents := make([]int, len(renames))
+	pending := make([]int, len(renames))
+	for i, rename := range renames {
+		parents[i] = -1
+		for dir := filepath.Dir(rename.From); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			if j, ok := index[dir]; ok {
+				parents[i] = j
+				pending[j]++
+				break
+			}
+		}
+	}
+
+	ready := make(chan int, len(renames))
+	// The queued renames are counted before the workers start to take them
+	var running int
+	for i := range renames {
+		if pending[i] == 0 {
+			ready <- i
+			running++
+		}
+	}
+	type done struct {
+		index int
+		err   error
+	}
+	results := make(chan done)
+	for n := 0; n < jobs; n++ {
+		go func() {
+			for i := range ready {
+				results <- done{index: i, err: renamePath(renames[i].From, renames[i].To)}
+			}
+		}()
+	}
+
+	errs := make([]error, len(renames))
+	var firstErr error
+	for running > 0 {
+		d := <-results
+		running--
+		errs[d.index] = d.err
+		if d.err != nil && !keepGoing {
+			// No more renames are scheduled, but the queued ones are waited for
+			if firstErr == nil {
+				firstErr = d.err
+			}
+			continue
+		}
+		// The ancestor can be renamed even if the rename of a descendant failed in -keep-going mode
+		if p := parents[d.index]; p >= 0 && firstErr == nil {
+			pending[p]--
+			if pending[p] == 0 {
+				running++
+				ready <- p
+			}
+		}
+	}
+	close(ready)
+	return errs, firstErr
+}
+
+// checkReferences warns about the files under the base dir which still refer to the renamed files or dirs.
+// An old name is looked for in any case with or without separators so that a reference in an uncovered form is found.
+func checkReferences(baseDir string, renames []renameResult, opts options) error {
+	files, err := findTargetFiles(baseDir, 0, opts)
+	if err != nil {
+		return err
+	}
+	files = textFiles(files)
+	type reference struct {
+		rename  renameResult
+		pattern *regexp.Regexp
+	}
+	var references []reference
+	for _, rename := range renames {
+		if pattern := referencePattern(rename.From); pattern != nil {
+			references = append(references, reference{rename: rename, pattern: pattern})
+		}
+	}
+	for _, file := range files {
+		bs, err := readContent(file.path, opts)
+		if err != nil {
+			return err
+		}
+		for _, ref := range references {
+			if ref.pattern.Match(bs) {
+				printWarn("%s: still refers to %s renamed to %s", file.path, ref.rename.From, ref.rename.To)
+			}
+		}
+	}
+	return nil
+}
+
+var referenceWordPattern = regexp.MustCompile(`\p{Lu}?[\p{Ll}\p{N}]+|\p{Lu}+`)
+
+// referencePattern returns the pattern of the stem of the path whose words may be in any case and separated by
+// "-", "_", ".", "/", a space or nothing, e.g. "user_profile.go" matches "UserProfile" and "user-profile".
+func referencePattern(path string) *regexp.Regexp {
+	name := filepath.Base(path)
+	words := referenceWordPattern.FindAllString(strings.TrimSuffix(name, filepath.Ext(name)), -1)
+	if len(words) == 0 {
+		return nil
+	}
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(words, `[-_./ ]?`))
+}
+
+// writeRenameScript writes the renames as a shell script of mv commands instead of executing them.
+func writeRenameScript(path string, renames []renameResult) error {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\nset -e\n")
+	for _, rename := range renames {
+		sb.WriteString(fmt.Sprintf("mv %s %s\n", shellQuote(rename.From), shellQuote(rename.To)))
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0755)
+}
+
+// runRenameHook runs the command with the shell after substituting {from} and {to} with the quoted paths.
+func runRenameHook(command string, from string, to string) error {
+	command = strings.NewReplacer("{from}", shellQuote(from), "{to}", shellQuote(to)).Replace(command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-on-rename command failed: %s: %w", command, err)
+	}
+	return nil
+}
+
+func shellQuote(str string) string {
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+func replaceFileName(name string, dict dict, opts options) string {
+	dict = dict.trimmedIf(opts.trimDict).postProcessed()
+	if opts.regex {
+		name, _ = replaceRegex(name, dict)
+		return name
+	}
+	if opts.exactFileName {
+		ext := filepath.Ext(name)
+		stem := strings.TrimSuffix(name, ext)
+		for _, it := range dict.items {
+			if stem == it.before || (opts.ignoreCaseFileName && strings.EqualFold(stem, it.before)) {
+				return it.after + ext
+			}
+		}
+		return name
+	}
+
+	replace := replaceWords
+	if opts.ignoreCaseFileName {
+		replace = replaceWordsIgnoringCase
+	}
+
+	if opts.keepExtension {
+		ext := filepath.Ext(name)
+		stem, _ := replace(strings.TrimSuffix(name, ext), dict)
+		return stem + ext
+	}
+
+	name, _ = replace(name, dict)
+	return name
+}
+
+// replaceWordsIgnoringCase is the same as replaceWords except that words are matched case-insensitively.
+func replaceWordsIgnoringCase(text string, dict dict) (string, int) {
+	var count int
+	for _, it := range dict.items {
+		pattern := regexp.MustCompile(`(?i)` + regexp.QuoteMeta(it.before))
+		count += len(pattern.FindAllStringIndex(text, -1))
+		text = pattern.ReplaceAllLiteralString(text, it.after)
+	}
+	return text, count
+}
+
+// renamePath renames the path and reports a failure with both the paths.
+func renamePath(beforePath string, afterPath string) error {
+	if err := renameCaseSafely(beforePath, afterPath); err != nil {
+		// The paths of a link error are replaced with the planned ones, which differ via a temporary name
+		var linkErr *os.LinkError
+		if errors.As(err, &linkErr) {
+			err = linkErr.Err
+		}
+		return fmt.Errorf("failed to rename %s => %s: %w", beforePath, afterPath, err)
+	}
+	return nil
+}
+
+// renameCaseSafely renames the path, going through a temporary path for a case-only rename
+// which can be ignored on a case-insensitive file system.
+func renameCaseSafely(beforePath string, afterPath string) error {
+	if !strings.EqualFold(beforePath, afterPath) {
+		return os.Rename(beforePath, afterPath)
+	}
+
+	tmpPath := fmt.Sprintf("%s.replace-word-%d", beforePath, os.Getpid())
+	if err := os.Rename(beforePath, tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, afterPath)
+}
+
+// watchDebounce is how long to wait for more changes before processing the changed files.
+const watchDebounce = 300 * time.Millisecond
+
+// watch re-applies the dictionary to the files added or modified under the base dirs until interrupted.
+func watch(baseDirs []string, dict dict, opts options) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	for _, baseDir := range baseDirs {
+		if err := watchDirs(watcher, baseDir, opts); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(messages, colorize(color.FgCyan, ">> Watching for changes..."))
+
+	changed := map[string]bool{}
+	// The files written by the watch itself are kept to ignore their events,
+	// which would replace an after word containing the before word again and again.
+	written := map[string]os.FileInfo{}
+	debounce := time.NewTimer(watchDebounce)
+	debounce.Stop()
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			// The name is joined to the watched dir as is, e.g. "./a.txt" for the dir "."
+			path := filepath.Clean(event.Name)
+			info, err := os.Stat(path)
+			if err == nil && info.IsDir() {
+				if err := watchDirs(watcher, path, opts); err != nil {
+					printWarn("can't watch %s: %s", path, err)
+				}
+			}
+			if prev, ok := written[path]; ok {
+				if err == nil && info.Size() == prev.Size() && info.ModTime().Equal(prev.ModTime()) {
+					continue
+				}
+				delete(written, path)
+			}
+			changed[path] = true
+			debounce.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			printWarn("watch: %s", err)
+		case <-debounce.C:
+			// An error is only printed to keep watching
+			results, err := replaceChangedFiles(baseDirs, changed, dict, opts)
+			if err != nil {
+				printError(err.Error())
+			}
+			for _, result := range results {
+				if info, err := os.Stat(result.path); err == nil {
+					written[filepath.Clean(result.path)] = info
+				}
+			}
+			changed = map[string]bool{}
+		}
+	}
+}
+
+// watchDirs adds the dir and its descendants to the watcher except the ignored and excluded dirs.
+func watchDirs(watcher *fsnotify.Watcher, dir string, opts options) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir {
+			for _, ignore := range ignoredDirs {
+				if d.Name() == ignore {
+					return filepath.SkipDir
+				}
+			}
+			if matchAny(opts.exclude, path) {
+				return filepath.SkipDir
+			}
+		}
+		return watcher.Add(path)
+	})
+}
+
+// replaceChangedFiles replaces words in the target files which are changed or under a changed dir,
+// and returns the results of the files it has changed.
+// The base dirs are scanned again so that the changed files are filtered in the same way as the initial run.
+func replaceChangedFiles(baseDirs []string, changed map[string]bool, dict dict, opts options) ([]fileResult, error) {
+	isChanged := func(path string) bool {
+		for ; ; path = filepath.Dir(path) {
+			if changed[path] {
+				return true
+			}
+			if path == filepath.Dir(path) {
+				return false
+			}
+		}
+	}
+	var files []targetFile
+	for _, baseDir := range baseDirs {
+		found, err := findTargetFiles(baseDir, 0, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range textFiles(found) {
+			if isChanged(filepath.Clean(file.path)) {
+				file.baseDir = baseDir
+				files = append(files, file)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	changedFiles, _, err := replaceText(files, dict, opts)
+	return changedFiles, err
+}
+
+// replaceArchive replaces words in the contents and the names of the entries of a .zip or .tar archive,
+// and writes the new archive to -archive-out or over the archive unless it's a dry run. Binary contents are kept as is.
+func replaceArchive(path string, textDict dict, fileNameDict dict, opts options) error {
+	outPath := opts.archiveOut
+	if outPath == "" {
+		outPath = path
+	}
+	var out io.Writer = io.Discard
+	var tmp *os.File
+	if !opts.dryRun {
+		var err error
+		tmp, err = os.CreateTemp(filepath.Dir(outPath), ".replace-word-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		// CreateTemp creates a file only readable by the owner
+		if info, err := os.Stat(path); err == nil {
+			if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		out = tmp
+	}
+
+	var err error
+	if filepath.Ext(path) == ".zip" {
+		err = replaceZip(path, out, textDict, fileNameDict, opts)
+	} else {
+		err = replaceTar(path, out, textDict, fileNameDict, opts)
+	}
+	if err != nil || tmp == nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outPath)
+}
+
+func replaceZip(path string, out io.Writer, textDict dict, fileNameDict dict, opts options) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w := zip.NewWriter(out)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		header := f.FileHeader
+		header.Name, content = replaceArchiveEntry(path, f.Name, content, textDict, fileNameDict, opts)
+		fw, err := w.CreateHeader(&header)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+func replaceTar(path string, out io.Writer, textDict dict, fileNameDict dict, opts options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	tw := tar.NewWriter(out)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			header.Name, content = replaceArchiveEntry(path, header.Name, content, textDict, fileNameDict, opts)
+			header.Size = int64(len(content))
+		} else {
+			header.Name, _ = replaceArchiveEntry(path, header.Name, nil, textDict, fileNameDict, opts)
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// replaceArchiveEntry returns the name and the content of an archive entry with the words replaced,
+// printing the diff and the rename. Each element of the slash-separated name is renamed.
+func replaceArchiveEntry(archive string, name string, content []byte, textDict dict, fileNameDict dict, opts options) (string, []byte) {
+	label := archive + ":" + name
+	if len(content) > 0 && isText(name, content, opts) {
+		before := string(content)
+		after, _ := replaceContent(name, before, textDict, opts)
+		if after != before {
+			fmt.Fprintln(output, colorizeDiff(elideLongLines(truncateDiff(unifiedDiff(label, before, after, diffAlgorithms[opts.diffAlgo]), opts.maxDiffLines))))
+			content = []byte(after)
+		}
+	}
+
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if elem != "" {
+			elems[i] = replaceFileName(elem, fileNameDict, opts)
+		}
+	}
+	if newName := strings.Join(elems, "/"); newName != name {
+		fmt.Fprintf(messages, "%s:%s => %s\n", archive, colorize(removeColor, name), colorize(addColor, newName))
+		name = newName
+	}
+	return name, content
+}
+
+// rewriteSymlinks replaces words in the target paths of symlinks under the dir and recreates the changed ones.
+func rewriteSymlinks(baseDir string, dict dict, opts options) error {
+	return filepath.WalkDir(baseDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == baseDir {
+			return nil
+		}
+		if d.IsDir() {
+			for _, ignore := range ignoredDirs {
+				if d.Name() == ignore {
+					return filepath.SkipDir
+				}
+			}
+			if matchAny(opts.exclude, path) {
+				return filepath.SkipDir
+			}
+			if rel, err := filepath.Rel(baseDir, path); err == nil && opts.maxDepth >= 0 && strings.Count(rel, string(filepath.Separator)) >= opts.maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&os.ModeSymlink == 0 || matchAny(opts.exclude, path) {
+			return nil
+		}
+
+		beforeTarget, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		var elems []string
+		for _, elem := range strings.Split(beforeTarget, string(filepath.Separator)) {
+			if elem != "." && elem != ".." {
+				elem = replaceFileName(elem, dict, opts)
+			}
+			elems = append(elems, elem)
+		}
+		afterTarget := strings.Join(elems, string(filepath.Separator))
+		if beforeTarget == afterTarget {
+			return nil
+		}
+
+		if !opts.dryRun {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			if err := os.Symlink(afterTarget, path); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(messages, "%s -> %s => %s\n", path, colorize(removeColor, beforeTarget), colorize(addColor, afterTarget))
+		logInfo("symlink", "path", path, "from", beforeTarget, "to", afterTarget)
+		return nil
+	})
+}
+
 func expandAncestorDirs(baseDir string, path string) []string {
 	var paths []string
 	paths = append(paths, path)
+	// Only the file itself is renamed if it's listed by -files-from outside the base dir,
+	// because its ancestor dirs aren't targets
+	if !isUnder(baseDir, path) {
+		return paths
+	}
 	dir, _ := filepath.Split(path)
 	dir = filepath.Dir(dir)
-	if dir != baseDir {
+	// Stop also at the root in case the path is not under the base dir
+	if !samePath(dir, baseDir) && dir != filepath.Dir(dir) {
 		paths = append(paths, expandAncestorDirs(baseDir, dir)...)
 	}
 	return paths
 }
 
+// isUnder reports whether the path is under the dir, regardless of whether they are relative or absolute.
+func isUnder(dir string, path string) bool {
+	absDir, errDir := filepath.Abs(dir)
+	absPath, errPath := filepath.Abs(path)
+	if errDir != nil || errPath != nil {
+		return true
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// samePath reports whether the paths point to the same location, regardless of whether they are relative or absolute.
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// fileReport is an element of the JSON report, which is a changed file or a renamed file or dir.
+type fileReport struct {
+	Path   string        `json:"path"`
+	Diff   string        `json:"diff,omitempty"`
+	Rename *renameResult `json:"rename,omitempty"`
+}
+
+func printJSONReport(results []fileResult, renames []renameResult) error {
+	reports := map[string]*fileReport{}
+	for _, result := range results {
+		reports[result.path] = &fileReport{Path: result.path, Diff: result.diff}
+	}
+	for i, rename := range renames {
+		report, ok := reports[rename.From]
+		if !ok {
+			report = &fileReport{Path: rename.From}
+			reports[rename.From] = report
+		}
+		report.Rename = &renames[i]
+	}
+
+	list := []*fileReport{}
+	for _, report := range reports {
+		list = append(list, report)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	bs, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Println(string(bs))
+	return err
+}
+
+// printJSONLine prints the report as a line of JSON to stdout as soon as a file is processed.
+func printJSONLine(report fileReport) {
+	bs, err := json.Marshal(report)
+	if err != nil {
+		printError(err.Error())
+		return
+	}
+	_, _ = os.Stdout.Write(append(bs, '\n'))
+}
+
+// writeRenameMap writes the renames as a JSON object from the old paths to the final paths,
+// where the paths under a renamed dir reflect the rename of the dir as well.
+func writeRenameMap(path string, renames []renameResult) error {
+	renamed := map[string]string{}
+	for _, rename := range renames {
+		renamed[rename.From] = rename.To
+	}
+	mapping := map[string]string{}
+	for _, rename := range renames {
+		mapping[rename.From] = finalPath(rename.From, renamed)
+	}
+	bs, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(bs, '\n'), 0644)
+}
+
+// finalPath returns the path after all the renames of itself and its ancestor dirs.
+func finalPath(path string, renamed map[string]string) string {
+	dir := filepath.Dir(path)
+	if dir == path {
+		return path
+	}
+	name := filepath.Base(path)
+	if to, ok := renamed[path]; ok {
+		name = filepath.Base(to)
+	}
+	return filepath.Join(finalPath(dir, renamed), name)
+}
+
+// writeReport writes a human-readable summary of the changed files and the renames to the file.
+func writeReport(path string, results []fileResult, renames []renameResult, opts options) error {
+	var sb strings.Builder
+	if opts.dictFile != "" {
+		fmt.Fprintf(&sb, "replace-word -dict-file=%s\n", opts.dictFile)
+	} else {
+		fmt.Fprintf(&sb, "replace-word %s => %s\n", opts.before, opts.after)
+	}
+	if opts.dryRun {
+		sb.WriteString("(dry run)\n")
+	}
+	var total int
+	for _, result := range results {
+		total += result.count
+	}
+	fmt.Fprintf(&sb, "\nChanged files: %d (%d replacements)\n", len(results), total)
+	for _, result := range results {
+		fmt.Fprintf(&sb, "  %s (%d replacements)\n", result.path, result.count)
+	}
+	fmt.Fprintf(&sb, "\nRenames: %d\n", len(renames))
+	for _, rename := range renames {
+		fmt.Fprintf(&sb, "  %s => %s\n", rename.From, rename.To)
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
+
+// printFilesToBeChanged prints the files whose content or name is to be changed to stdout and returns the number of them.
+func printFilesToBeChanged(results []fileResult, renames []renameResult) int {
+	var paths []string
+	found := map[string]bool{}
+	for _, result := range results {
+		paths = append(paths, result.path)
+		found[result.path] = true
+	}
+	for _, rename := range renames {
+		if !found[rename.From] {
+			paths = append(paths, rename.From)
+			found[rename.From] = true
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Println(path)
+	}
+	return len(paths)
+}
+
+func printTiming(files int, scan time.Duration, replace time.Duration, rename time.Duration) {
+	total := scan + replace + rename
+	var throughput float64
+	if total > 0 {
+		throughput = float64(files) / total.Seconds()
+	}
+	_, _ = fmt.Fprintln(os.Stderr, colorize(color.FgCyan, ">> Timing"))
+	_, _ = fmt.Fprintf(os.Stderr, "scan:    %s\n", scan)
+	_, _ = fmt.Fprintf(os.Stderr, "replace: %s\n", replace)
+	_, _ = fmt.Fprintf(os.Stderr, "rename:  %s\n", rename)
+	_, _ = fmt.Fprintf(os.Stderr, "total:   %s (%d files, %.1f files/s)\n", total, files, throughput)
+}
+
 func printError(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Error(fmt.Sprintf(format, args...))
+		return
+	}
 	_, _ = fmt.Fprintln(os.Stderr, colorize(color.FgRed, "ERROR: "+format, args...))
 }
 
+func printWarn(format string, args ...interface{}) {
+	if logger != nil {
+		logger.Warn(fmt.Sprintf(format, args...))
+		return
+	}
+	_, _ = fmt.Fprintln(os.Stderr, colorize(color.FgYellow, "WARN: "+format, args...))
+}
+
+// logInfo logs the message with the key-value pairs if -log-format is specified.
+func logInfo(msg string, args ...interface{}) {
+	if logger != nil {
+		logger.Info(msg, args...)
+	}
+}
+
+// newLogger returns a logger writing the records in the format to stderr, keeping stdout for diffs.
+func newLogger(format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// colorNames are the names of the colors for -color-add and -color-remove.
+var colorNames = map[string]color.Attribute{
+	"black":      color.FgBlack,
+	"red":        color.FgRed,
+	"green":      color.FgGreen,
+	"yellow":     color.FgYellow,
+	"blue":       color.FgBlue,
+	"magenta":    color.FgMagenta,
+	"cyan":       color.FgCyan,
+	"white":      color.FgWhite,
+	"hi-black":   color.FgHiBlack,
+	"hi-red":     color.FgHiRed,
+	"hi-green":   color.FgHiGreen,
+	"hi-yellow":  color.FgHiYellow,
+	"hi-blue":    color.FgHiBlue,
+	"hi-magenta": color.FgHiMagenta,
+	"hi-cyan":    color.FgHiCyan,
+	"hi-white":   color.FgHiWhite,
+}
+
+// sortedColorNames returns the names of the colors in alphabetical order.
+func sortedColorNames() []string {
+	var names []string
+	for name := range colorNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func colorize(attr color.Attribute, format string, args ...interface{}) string {
 	return color.New(attr).Sprintf(format, args...)
 }
@@ -0,0 +1,4548 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// mainEnv is the environment variable which makes the re-executed test binary run main instead of the tests.
+const mainEnv = "REPLACE_WORD_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(mainEnv) == "1" {
+		// The flags of the test binary are replaced with those of the CLI
+		flag.CommandLine = flag.NewFlagSet("replace-word", flag.ExitOnError)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// cliResult is the result of a run of the CLI.
+type cliResult struct {
+	stdout string
+	stderr string
+	code   int
+}
+
+// runCLI runs the CLI with the arguments in the dir as a separate process, feeding the input to stdin.
+func runCLI(t *testing.T, dir string, input string, args ...string) cliResult {
+	t.Helper()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), mainEnv+"=1")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil && !errors.As(err, new(*exec.ExitError)) {
+		t.Fatal(err)
+	}
+	return cliResult{stdout: stdout.String(), stderr: stderr.String(), code: cmd.ProcessState.ExitCode()}
+}
+
+// writeTree builds a tree of files under a temporary dir from the map of slash-separated relative paths to contents,
+// and returns the dir. A path ending with a slash is an empty dir.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readTree snapshots the tree under the dir in the same form as writeTree takes.
+// A symlink is represented by its target prefixed with "-> ".
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			files[name] = "-> " + target
+		case d.IsDir():
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				files[name+"/"] = ""
+			}
+		default:
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			files[name] = string(bs)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// parseOptions parses the command line arguments into the options in the same way as main.
+func parseOptions(t *testing.T, args ...string) options {
+	t.Helper()
+	opts, err := tryParseOptions(t, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return opts
+}
+
+// tryParseOptions is the same as parseOptions except that an error of the arguments is returned.
+func tryParseOptions(t *testing.T, args ...string) (opts options, err error) {
+	t.Helper()
+	commandLine, osArgs := flag.CommandLine, os.Args
+	t.Cleanup(func() {
+		flag.CommandLine, os.Args = commandLine, osArgs
+	})
+	// An invalid flag panics instead of exiting, whose error is returned
+	flag.CommandLine = flag.NewFlagSet("replace-word", flag.PanicOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	os.Args = append([]string{"replace-word"}, args...)
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return parseArgs()
+}
+
+// discardOutput discards the diffs and the messages written during the test.
+func discardOutput(t *testing.T) {
+	t.Helper()
+	prevOutput, prevMessages := output, messages
+	t.Cleanup(func() {
+		output, messages = prevOutput, prevMessages
+	})
+	output, messages = io.Discard, io.Discard
+}
+
+// findTargets returns the text files under the dir to be processed with the options.
+func findTargets(t *testing.T, dir string, opts options) []targetFile {
+	t.Helper()
+	files, err := findTargetFiles(dir, 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range files {
+		files[i].baseDir = dir
+	}
+	return files
+}
+
+func TestReplaceText(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  map[string]string
+	}{
+		{
+			name: "all forms",
+			files: map[string]string{
+				"a.txt": "UserProfile userProfile USER_PROFILE user_profile USER-PROFILE user-profile\nUSERPROFILE userprofile User Profile User profile user profile\n",
+			},
+			args: []string{"user-profile", "member-account"},
+			want: map[string]string{
+				"a.txt": "MemberAccount memberAccount MEMBER_ACCOUNT member_account MEMBER-ACCOUNT member-account\nMEMBERACCOUNT memberaccount Member Account Member account member account\n",
+			},
+		},
+		{
+			name: "nested files",
+			files: map[string]string{
+				"a.go":       "type User struct{}\n",
+				"sub/b.go":   "var user User\n",
+				"sub/c/d.md": "# User\n",
+			},
+			args: []string{"user", "member"},
+			want: map[string]string{
+				"a.go":       "type Member struct{}\n",
+				"sub/b.go":   "var member Member\n",
+				"sub/c/d.md": "# Member\n",
+			},
+		},
+		{
+			name: "no match",
+			files: map[string]string{
+				"a.txt": "nothing to replace\n",
+			},
+			args: []string{"user", "member"},
+			want: map[string]string{
+				"a.txt": "nothing to replace\n",
+			},
+		},
+		{
+			name: "dry run",
+			files: map[string]string{
+				"a.txt": "user\n",
+			},
+			args: []string{"-dry-run", "user", "member"},
+			want: map[string]string{
+				"a.txt": "user\n",
+			},
+		},
+		{
+			name: "ignored dirs",
+			files: map[string]string{
+				"a.txt":         "user\n",
+				".git/config":   "user\n",
+				".idea/a.xml":   "user\n",
+				"node_modules/": "",
+			},
+			args: []string{"user", "member"},
+			want: map[string]string{
+				"a.txt":         "member\n",
+				".git/config":   "user\n",
+				".idea/a.xml":   "user\n",
+				"node_modules/": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, tt.files)
+			opts := parseOptions(t, append([]string{"-dir", dir}, tt.args...)...)
+			if _, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameFilesAndDirs(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		args        []string
+		want        map[string]string
+		wantRenames int
+	}{
+		{
+			name: "file",
+			files: map[string]string{
+				"user-profile.txt": "",
+				"other.txt":        "",
+			},
+			args: []string{"user-profile", "member-account"},
+			want: map[string]string{
+				"member-account.txt": "",
+				"other.txt":          "",
+			},
+			wantRenames: 1,
+		},
+		{
+			name: "dirs from leaf to root",
+			files: map[string]string{
+				"user_profile/UserProfile.go":       "",
+				"user_profile/userProfile/index.js": "",
+			},
+			args: []string{"user-profile", "member-account"},
+			want: map[string]string{
+				"member_account/MemberAccount.go":       "",
+				"member_account/memberAccount/index.js": "",
+			},
+			wantRenames: 3,
+		},
+		{
+			name: "no match",
+			files: map[string]string{
+				"a.txt": "",
+			},
+			args: []string{"user", "member"},
+			want: map[string]string{
+				"a.txt": "",
+			},
+		},
+		{
+			name: "dry run",
+			files: map[string]string{
+				"user/user.txt": "",
+			},
+			args: []string{"-dry-run", "user", "member"},
+			want: map[string]string{
+				"user/user.txt": "",
+			},
+			wantRenames: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, tt.files)
+			opts := parseOptions(t, append([]string{"-dir", dir}, tt.args...)...)
+			renames, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(renames) != tt.wantRenames {
+				t.Errorf("got %d renames %v, want %d", len(renames), renames, tt.wantRenames)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// relativePaths returns the sorted slash-separated paths of the files relative to the dir.
+func relativePaths(t *testing.T, dir string, files []targetFile) []string {
+	t.Helper()
+	var paths []string
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestForceText(t *testing.T) {
+	// A NUL byte makes the content sniffed as binary
+	files := map[string]string{
+		"app.min.js": "var user=1;\x00",
+		"a.txt":      "user\n",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "sniffed", want: []string{"a.txt"}},
+		{name: "forced", args: []string{"-force-text", "*.min.js"}, want: []string{"a.txt", "app.min.js"}},
+		{name: "not matched", args: []string{"-force-text", "*.css"}, want: []string{"a.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			targets := textFiles(findTargets(t, dir, opts))
+			if got := relativePaths(t, dir, targets); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if _, _, err := replaceText(targets, generateDictForText(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := readTree(t, dir)["app.min.js"] == "var member=1;\x00", len(tt.want) == 2; got != want {
+				t.Errorf("got replaced %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFileNameForm(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{
+		"user-profile.md":  "",
+		"UserProfile.go":   "",
+		"user_profile.txt": "",
+	})
+	opts := parseOptions(t, "-dir", dir, "-filename-form", "kebab", "user-profile", "member-account")
+	if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForForm(opts.before, opts.after, opts.fileNameForm), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"member-account.md": "",
+		"UserProfile.go":    "",
+		"user_profile.txt":  "",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := tryParseOptions(t, "-filename-form", "camel-kebab", "user", "member"); err == nil {
+		t.Error("unknown form is accepted")
+	}
+}
+
+func TestEmptyTargets(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+	}{
+		{name: "filtered", args: []string{"-include", "*.go"}, wantCode: 0},
+		{name: "filtered with -error-on-empty", args: []string{"-include", "*.go", "-error-on-empty"}, wantCode: 1},
+		{name: "excluded", args: []string{"-exclude", "*.txt"}, wantCode: 0},
+		{name: "not filtered", args: []string{"-dir", "empty"}, wantCode: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, map[string]string{"a.txt": "user\n", "empty/": ""})
+			result := runCLI(t, dir, "", append(tt.args, "user", "member")...)
+			if result.code != tt.wantCode {
+				t.Errorf("got exit code %d, want %d: %s", result.code, tt.wantCode, result.stderr)
+			}
+			want := "WARN: no target files"
+			if tt.wantCode != 0 {
+				want = "ERROR: no target files"
+			}
+			if !strings.Contains(result.stderr, want) {
+				t.Errorf("got %q, want %q", result.stderr, want)
+			}
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("OLD_NAME", "user-profile")
+	t.Setenv("NEW_NAME", "member-account")
+	t.Setenv("SPACED_NAME", "member account")
+
+	opts := parseOptions(t, "-expand-env", "$OLD_NAME", "${NEW_NAME}")
+	if opts.before != "user-profile" || opts.after != "member-account" {
+		t.Errorf("got %q and %q", opts.before, opts.after)
+	}
+	opts = parseOptions(t, "$OLD_NAME", "$NEW_NAME")
+	if opts.before != "$OLD_NAME" || opts.after != "$NEW_NAME" {
+		t.Errorf("expanded without -expand-env: %q and %q", opts.before, opts.after)
+	}
+	if _, err := tryParseOptions(t, "-expand-env", "$OLD_NAME", "$SPACED_NAME"); err == nil {
+		t.Error("expanded argument which is not hyphenated words is accepted")
+	}
+	if _, err := tryParseOptions(t, "-expand-env", "-literal", "$OLD_NAME", "$SPACED_NAME"); err != nil {
+		t.Errorf("expanded literal argument is rejected: %s", err)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	files := map[string]string{
+		"a.txt":       "",
+		"b/b.txt":     "",
+		"b/c/c.txt":   "",
+		"b/c/d/d.txt": "",
+	}
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"-max-depth", "0"}, want: []string{"a.txt"}},
+		{args: []string{"-max-depth", "1"}, want: []string{"a.txt", "b/b.txt"}},
+		{args: []string{"-max-depth", "2"}, want: []string{"a.txt", "b/b.txt", "b/c/c.txt"}},
+		{args: []string{"-max-depth", "-1"}, want: []string{"a.txt", "b/b.txt", "b/c/c.txt", "b/c/d/d.txt"}},
+		{args: nil, want: []string{"a.txt", "b/b.txt", "b/c/c.txt", "b/c/d/d.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			if got := relativePaths(t, dir, findTargets(t, dir, opts)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := tryParseOptions(t, "-max-depth", "-2", "user", "member"); err == nil {
+		t.Error("negative depth other than -1 is accepted")
+	}
+}
+
+func TestExactFileName(t *testing.T) {
+	files := map[string]string{
+		"user.go":        "",
+		"user-helper.go": "",
+		"User.java":      "",
+		"user/a.txt":     "",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "substring",
+			want: map[string]string{
+				"member.go":        "",
+				"member-helper.go": "",
+				"Member.java":      "",
+				"member/a.txt":     "",
+			},
+		},
+		{
+			name: "exact",
+			args: []string{"-exact-filename"},
+			want: map[string]string{
+				"member.go":      "",
+				"user-helper.go": "",
+				"Member.java":    "",
+				"member/a.txt":   "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTiming(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "user\n", "b.txt": "user\n"})
+	result := runCLI(t, dir, "", "-dry-run", "-timing", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("got exit code %d: %s", result.code, result.stderr)
+	}
+	for _, pattern := range []string{
+		`(?m)^>> Timing$`,
+		`(?m)^scan: +\S+$`,
+		`(?m)^replace: +\S+$`,
+		`(?m)^rename: +\S+$`,
+		`(?m)^total: +\S+ \(2 files, [0-9.]+ files/s\)$`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(result.stderr) {
+			t.Errorf("%s doesn't match %q", pattern, result.stderr)
+		}
+	}
+
+	result = runCLI(t, dir, "", "-dry-run", "user", "member")
+	if strings.Contains(result.stderr, "Timing") {
+		t.Errorf("timing is printed without -timing: %q", result.stderr)
+	}
+}
+
+func TestDictionaryOut(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "user profile\n"})
+	result := runCLI(t, dir, "", "-dry-run", "-dictionary-out", "dict.json", "user-profile", "member-account")
+	if result.code != 0 {
+		t.Fatalf("got exit code %d: %s", result.code, result.stderr)
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, "dict.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string][]map[string]string
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatalf("%s: %s", err, bs)
+	}
+	if len(got) != 2 || len(got["text"]) != 11 || len(got["fileName"]) != 8 {
+		t.Fatalf("got %v", got)
+	}
+	for kind, items := range got {
+		for _, item := range items {
+			if len(item) != 3 || item["form"] == "" || item["before"] == "" || item["after"] == "" {
+				t.Errorf("invalid item of %s: %v", kind, item)
+			}
+		}
+	}
+	want := map[string]string{"form": "lower-space", "before": "user profile", "after": "member account"}
+	if item := got["text"][10]; !reflect.DeepEqual(item, want) {
+		t.Errorf("got %v, want %v", item, want)
+	}
+}
+
+func TestDictJSON(t *testing.T) {
+	d := generateDictForText("user-profile", "member-account")
+	bs, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got dict
+	if err := json.Unmarshal(bs, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, d) {
+		t.Errorf("got %v, want %v", got, d)
+	}
+	if got.String() != d.String() {
+		t.Errorf("got %q, want %q", got.String(), d.String())
+	}
+
+	if bs, err := json.Marshal(dict{}); err != nil || string(bs) != "[]" {
+		t.Errorf("got %s, %v for an empty dict", bs, err)
+	}
+	if got, want := (dictItem{form: "kebab", before: "user", after: "member"}).String(), `"user" => "member"`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOnRename(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"user's.txt": "", "user/a.txt": ""})
+	log := filepath.Join(t.TempDir(), "log")
+	opts := parseOptions(t, "-dir", dir, "-on-rename", "echo {from} {to} >> "+shellQuote(log), "user", "member")
+	if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	bs, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, "user's.txt") + " " + filepath.Join(dir, "member's.txt") + "\n" +
+		filepath.Join(dir, "user") + " " + filepath.Join(dir, "member") + "\n"
+	if string(bs) != want {
+		t.Errorf("got %q, want %q", bs, want)
+	}
+}
+
+func TestOnRenameErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+		want    map[string]string
+	}{
+		{
+			name:    "fatal",
+			wantErr: true,
+			// The renames are run in the reverse order of the paths
+			want: map[string]string{"a/user.txt": "", "b/member.txt": ""},
+		},
+		{
+			name: "ignored",
+			args: []string{"-ignore-on-rename-errors"},
+			want: map[string]string{"a/member.txt": "", "b/member.txt": ""},
+		},
+		{
+			name: "dry run",
+			args: []string{"-dry-run"},
+			want: map[string]string{"a/user.txt": "", "b/user.txt": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, map[string]string{"a/user.txt": "", "b/user.txt": ""})
+			opts := parseOptions(t, append(append([]string{"-dir", dir, "-on-rename", "exit 3"}, tt.args...), "user", "member")...)
+			_, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "-on-rename command failed: exit 3") {
+				t.Errorf("got %q", err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteSymlinks(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		t.Run(fmt.Sprintf("dry run %v", dryRun), func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, map[string]string{"user-service/x": "", "a.txt": ""})
+			for link, target := range map[string]string{"app/link": "../user-service/x", "other": "a.txt"} {
+				path := filepath.Join(dir, filepath.FromSlash(link))
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(filepath.FromSlash(target), path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			opts := parseOptions(t, "-dir", dir, fmt.Sprintf("-dry-run=%v", dryRun), "-rewrite-symlinks", "user", "member")
+			if err := rewriteSymlinks(dir, generateDictForFileName(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]string{
+				"user-service/x": "",
+				"a.txt":          "",
+				"app/link":       "-> ../member-service/x",
+				"other":          "-> a.txt",
+			}
+			if dryRun {
+				want["app/link"] = "-> ../user-service/x"
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRewriteSymlinksWithRenames(t *testing.T) {
+	dir := writeTree(t, map[string]string{"user-service/x": "user\n"})
+	if err := os.Symlink(filepath.FromSlash("user-service/x"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	result := runCLI(t, dir, "y\n", "-rewrite-symlinks", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("got exit code %d: %s", result.code, result.stderr)
+	}
+	want := map[string]string{"member-service/x": "member\n", "link": "-> member-service/x"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// replaceString replaces words in the text of a file at the path with the arguments as replaceText does.
+func replaceString(t *testing.T, path string, text string, args ...string) string {
+	t.Helper()
+	opts := parseOptions(t, args...)
+	d := generateDictForText(opts.before, opts.after).ordered(opts.formOrder)
+	if opts.regex {
+		d = generateDictForRegex(opts.before, opts.after)
+	}
+	if opts.literal {
+		d = generateDictForLiteral(opts.before, opts.after)
+	}
+	replaced, _ := replaceContent(path, text, d, opts)
+	return replaced
+}
+
+func TestSkipFrontMatter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "front matter",
+			text: "---\nuser: user\n---\n# user\n",
+			want: "---\nuser: user\n---\n# member\n",
+		},
+		{
+			name: "CRLF",
+			text: "---\r\nuser: user\r\n---\r\n# user\r\n",
+			want: "---\r\nuser: user\r\n---\r\n# member\r\n",
+		},
+		{
+			name: "no front matter",
+			text: "# user\n---\nuser: user\n---\n",
+			want: "# member\n---\nmember: member\n---\n",
+		},
+		{
+			name: "only front matter",
+			text: "---\nuser: user\n---",
+			want: "---\nuser: user\n---",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, "a.md", tt.text, "-skip-frontmatter", "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := replaceString(t, "a.md", "---\nuser: user\n---\n", "user", "member"), "---\nmember: member\n---\n"; got != want {
+		t.Errorf("got %q, want %q without -skip-frontmatter", got, want)
+	}
+}
+
+var update = flag.Bool("update", false, "Update the golden files under testdata")
+
+// assertGolden compares the output with the golden file under testdata, which is rewritten with -update.
+func assertGolden(t *testing.T, name string, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", filepath.FromSlash(name))
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(bs) {
+		t.Errorf("got %q, want %q in %s", got, bs, path)
+	}
+}
+
+// enableColor colors the output during the test regardless of the terminal.
+func enableColor(t *testing.T) {
+	t.Helper()
+	noColor, add, remove := color.NoColor, addColor, removeColor
+	t.Cleanup(func() {
+		color.NoColor, addColor, removeColor = noColor, add, remove
+	})
+	color.NoColor = false
+}
+
+func TestDiffGolden(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	long := strings.Join(lines, "\n") + "\n"
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "addition", a: "a\nb\n", b: "a\nb\nc\n"},
+		{name: "deletion", a: "a\nb\nc\n", b: "a\nc\n"},
+		{name: "change", a: "type User struct{}\n", b: "type Member struct{}\n"},
+		{name: "multi-hunk", a: long, b: strings.NewReplacer("line 2\n", "line two\n", "line 18\n", "line eighteen\n").Replace(long)},
+		{name: "header-like", a: "---user\n+++user\n--- a/b.txt\n", b: "---member\n+++member\n--- a/b.txt\n"},
+		{name: "no-newline", a: "user", b: "member"},
+		{name: "header-of-content", a: "-- a/a.txt\n++ b/a.txt\n", b: "-- a/user.txt\n++ b/user.txt\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enableColor(t)
+			diff := unifiedDiff("a.txt", tt.a, tt.b, diffAlgorithms["myers"])
+			assertGolden(t, "diff/"+tt.name+".diff", diff)
+			assertGolden(t, "diff/"+tt.name+".colored.diff", colorizeDiff(diff))
+		})
+	}
+}
+
+func TestColorizeDiffHeaders(t *testing.T) {
+	enableColor(t)
+	diff := unifiedDiff("a.txt", "---user\n", "---member\n", diffAlgorithms["myers"])
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n" + colorize(removeColor, "----user") + "\n" + colorize(addColor, "+---member") + "\n"
+	if got := colorizeDiff(diff); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The headers are left as they are even if the hunks are truncated
+	truncated := truncateDiff(diff, 2)
+	if got := colorizeDiff(truncated); got != truncated {
+		t.Errorf("got %q, want %q", got, truncated)
+	}
+}
+
+// writeGzip writes the gzipped content with the name in the header to the path with the mode.
+func writeGzip(t *testing.T, path string, name string, content string, mode os.FileMode) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Name = name
+	if _, err := w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGzip(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		t.Run(fmt.Sprintf("gzip %v", gz), func(t *testing.T) {
+			discardOutput(t)
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.json.gz")
+			writeGzip(t, path, "config.json", `{"name": "user"}`, 0600)
+			opts := parseOptions(t, "-dir", dir, fmt.Sprintf("-gzip=%v", gz), "user", "member")
+			files := textFiles(findTargets(t, dir, opts))
+			if len(files) != map[bool]int{false: 0, true: 1}[gz] {
+				t.Fatalf("got %v", files)
+			}
+			if _, _, err := replaceText(files, generateDictForText(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			r, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bs, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `{"name": "user"}`
+			if gz {
+				want = `{"name": "member"}`
+			}
+			if string(bs) != want || r.Name != "config.json" {
+				t.Errorf("got %q named %q, want %q", bs, r.Name, want)
+			}
+			if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("got mode %v, %v", info.Mode(), err)
+			}
+		})
+	}
+}
+
+func TestGzipBroken(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"a.txt.gz": "user\n"})
+	opts := parseOptions(t, "-dir", dir, "-gzip", "-force-text", "*.gz", "user", "member")
+	_, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts)
+	if !errors.As(err, new(encodingError)) {
+		t.Errorf("got %v, want an encoding error", err)
+	}
+}
+
+func TestBinaryStrings(t *testing.T) {
+	discardOutput(t)
+	bin := "\x00\x01\xffUSER_ID=user\x00\x02User\xfe"
+	dir := writeTree(t, map[string]string{"a.bin": bin, "a.txt": "user\n"})
+	opts := parseOptions(t, "-dir", dir, "-binary-strings", "user", "abcd")
+	d := generateDictForText(opts.before, opts.after)
+	if err := validateBinaryStrings(d); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := replaceText(textFiles(findTargets(t, dir, opts)), d, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.bin": "\x00\x01\xffABCD_ID=abcd\x00\x02Abcd\xfe", "a.txt": "abcd\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestValidateBinaryStrings(t *testing.T) {
+	tests := []struct {
+		before, after string
+		wantErr       string
+	}{
+		{before: "user", after: "abcd"},
+		{before: "user", after: "member", wantErr: "-binary-strings requires words of the same length"},
+		{before: "user", after: "ユーザ", wantErr: "-binary-strings requires words of the same length"},
+		{before: "usér", after: "abcd", wantErr: "-binary-strings requires words of the same length"},
+		{before: "usé", after: "abcd", wantErr: "-binary-strings requires ASCII words"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.before+" "+tt.after, func(t *testing.T) {
+			err := validateBinaryStrings(generateDictForLiteral(tt.before, tt.after))
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// captureOutput captures the diffs written during the test, discarding the messages.
+func captureOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	discardOutput(t)
+	var buf bytes.Buffer
+	output = &buf
+	return &buf
+}
+
+func TestJobsOrder(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 50; i++ {
+		// Earlier files are larger so that they tend to be completed later with multiple jobs
+		files[fmt.Sprintf("d%d/f%02d.txt", i%3, i)] = strings.Repeat("user\n", (50-i)*4)
+	}
+	dir := writeTree(t, files)
+	run := func(jobs int) (string, []string) {
+		buf := captureOutput(t)
+		opts := parseOptions(t, "-dir", dir, "-dry-run", "-jobs", strconv.Itoa(jobs), "user", "member")
+		changed, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, result := range changed {
+			paths = append(paths, result.path)
+		}
+		return buf.String(), paths
+	}
+	wantOutput, wantPaths := run(1)
+	if len(wantPaths) != 50 {
+		t.Fatalf("got %d changed files", len(wantPaths))
+	}
+	for _, jobs := range []int{2, 8, 64} {
+		gotOutput, gotPaths := run(jobs)
+		if !reflect.DeepEqual(gotPaths, wantPaths) {
+			t.Errorf("got %v with %d jobs, want %v", gotPaths, jobs, wantPaths)
+		}
+		if gotOutput != wantOutput {
+			t.Errorf("output with %d jobs differs from that with a job", jobs)
+		}
+	}
+}
+
+func TestKeepExtension(t *testing.T) {
+	files := map[string]string{"user.user": "", "user/a.user": "", "a.txt": ""}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "whole name",
+			want: map[string]string{"member.member": "", "member/a.member": "", "a.txt": ""},
+		},
+		{
+			name: "stem",
+			args: []string{"-keep-extension"},
+			want: map[string]string{"member.user": "", "member/a.user": "", "a.txt": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTree(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a.txt":            "user\n",
+		"sub/b.txt":        "user\nUser\n",
+		"sub/deep/c.txt":   "USER\n",
+		"sub/deep/d.txt":   "nothing\n",
+		"other/e/f/g.txt":  "user\n",
+		"other/e/f/h.txt":  "user user\n",
+		"other/unused.txt": "",
+	})
+	buf := captureOutput(t)
+	opts := parseOptions(t, "-dir", dir, "-dry-run", "-tree", "user", "member")
+	if _, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	indent := regexp.MustCompile(`^ *`)
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line == dir || strings.HasSuffix(line, "/") || strings.HasSuffix(line, " replacements)") {
+			got = append(got, line)
+			continue
+		}
+		// A diff is indented under its file
+		if line != "" && len(indent.FindString(line)) < 4 {
+			t.Errorf("diff line not indented: %q", line)
+		}
+	}
+	want := []string{
+		dir,
+		"  a.txt (1 replacements)",
+		"  other/",
+		"    e/",
+		"      f/",
+		"        g.txt (1 replacements)",
+		"        h.txt (2 replacements)",
+		"  sub/",
+		"    b.txt (2 replacements)",
+		"    deep/",
+		"      c.txt (1 replacements)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMaxReplacementsPerFile(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{
+		"many.txt": strings.Repeat("user\n", 4),
+		"few.txt":  strings.Repeat("user\n", 3),
+	})
+	opts := parseOptions(t, "-dir", dir, "-max-replacements-per-file", "3", "user", "member")
+	changed, skipped, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changed) != 1 || len(skipped) != 1 || skipped[0].skipped != "too many replacements" || filepath.Base(skipped[0].path) != "many.txt" {
+		t.Errorf("got changed %v and skipped %v", changed, skipped)
+	}
+	want := map[string]string{
+		"many.txt": strings.Repeat("user\n", 4),
+		"few.txt":  strings.Repeat("member\n", 3),
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFormsFor(t *testing.T) {
+	discardOutput(t)
+	content := "UserProfile userProfile user-profile user_profile\n"
+	dir := writeTree(t, map[string]string{"a.go": content, "a.css": content, "a.txt": content})
+	opts := parseOptions(t, "-dir", dir, "-forms-for", ".go:upper-camel,lower-camel", "-forms-for", ".css:kebab", "user-profile", "member-account")
+	if _, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.go":  "MemberAccount memberAccount user-profile user_profile\n",
+		"a.css": "UserProfile userProfile member-account user_profile\n",
+		"a.txt": "MemberAccount memberAccount member-account member_account\n",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, value := range []string{".go:camel", ".go", ":kebab", ".go:"} {
+		if _, err := tryParseOptions(t, "-forms-for", value, "user", "member"); err == nil {
+			t.Errorf("%q is accepted", value)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	files := map[string]string{"user.txt": "user\n"}
+	for i := 1; i <= 4; i++ {
+		files[fmt.Sprintf("%d.txt", i)] = "user\n"
+	}
+	dir := writeTree(t, files)
+	result := runCLI(t, dir, "", "-sample", "2", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("got exit code %d: %s", result.code, result.stderr)
+	}
+	if got := strings.Count(result.stdout, "\n--- a/"); got != 2 {
+		t.Errorf("got %d diffs: %s", got, result.stdout)
+	}
+	if !strings.Contains(result.stdout, "2 of 5 files to be changed are shown") {
+		t.Errorf("no total: %s", result.stdout)
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("got %v, want %v", got, files)
+	}
+
+	if _, err := tryParseOptions(t, "-sample", "2", "-rename-only", "user", "member"); err == nil {
+		t.Error("-sample with -rename-only is accepted")
+	}
+}
+
+func TestTargetFileInfo(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "user\n", "sub/b.txt": "user user\n"})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	opts := parseOptions(t, "-dir", dir, "user", "member")
+	files := findTargets(t, dir, opts)
+	if len(files) != 3 {
+		t.Fatalf("got %v", files)
+	}
+	for _, file := range files {
+		stat, err := os.Stat(file.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.info == nil || file.info.Size() != stat.Size() || !file.info.ModTime().Equal(stat.ModTime()) || file.info.Mode() != stat.Mode() {
+			t.Errorf("%s: got info %v, want %v", file.path, file.info, stat)
+		}
+	}
+}
+
+func TestPreserveMtime(t *testing.T) {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, preserve := range []bool{false, true} {
+		t.Run(fmt.Sprintf("preserve %v", preserve), func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, map[string]string{"a.txt": "user\n"})
+			path := filepath.Join(dir, "a.txt")
+			if err := os.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			opts := parseOptions(t, "-dir", dir, fmt.Sprintf("-preserve-mtime=%v", preserve), "user", "member")
+			if _, _, err := replaceText(textFiles(findTargets(t, dir, opts)), generateDictForText(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.ModTime().Equal(mtime) != preserve {
+				t.Errorf("got mtime %v", info.ModTime())
+			}
+			if bs, _ := os.ReadFile(path); string(bs) != "member\n" {
+				t.Errorf("got %q", bs)
+			}
+		})
+	}
+}
+
+func TestIgnoreCaseFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "case-sensitive", want: map[string]string{"User_Config.json": ""}},
+		{name: "case-insensitive", args: []string{"-ignore-case-filename"}, want: map[string]string{"MEMBER_CONFIG.json": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, map[string]string{"User_Config.json": ""})
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user-config", "member-config")...)
+			if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseOnlyRename(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"user/user.go": "package user\n"})
+	opts := parseOptions(t, "-dir", dir, "-literal", "user", "User")
+	renames, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForLiteral(opts.before, opts.after), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renames) != 2 {
+		t.Errorf("got %v", renames)
+	}
+	// No temporary path is left
+	want := map[string]string{"User/User.go": "package user\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCaseOnlyRenameWarning(t *testing.T) {
+	dir := writeTree(t, map[string]string{"user.txt": "user\n"})
+	result := runCLI(t, dir, "y\n", "-literal", "user", "User")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if !strings.Contains(result.stderr, "user.txt: only the case is changed, which is renamed via a temporary name") {
+		t.Errorf("no warning: %s", result.stderr)
+	}
+	want := map[string]string{"User.txt": "User\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestProse(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		before, after string
+		want          string
+	}{
+		{
+			name:   "punctuation",
+			text:   "user, user. (user) \"user\" user's user!\n",
+			before: "user", after: "member",
+			want: "member, member. (member) \"member\" member's member!\n",
+		},
+		{
+			// An underscore is a punctuation which delimits words
+			name:   "larger words",
+			text:   "users superuser user2 User user_id\n",
+			before: "user", after: "member",
+			want: "users superuser user2 Member member_id\n",
+		},
+		{
+			name:   "non-ASCII",
+			text:   "café, cafés, décafé; Café\n",
+			before: "café", after: "bar",
+			want: "bar, cafés, décafé; Bar\n",
+		},
+		{
+			name:   "non-ASCII delimiters",
+			text:   "「ユーザ」とユーザー、ユーザ。\n",
+			before: "ユーザ", after: "会員",
+			want: "「会員」とユーザー、会員。\n",
+		},
+		{
+			name:   "space forms",
+			text:   "User Profile is user profiles.\n",
+			before: "user-profile", after: "member-account",
+			want: "Member Account is user profiles.\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, "a.md", tt.text, "-prose", tt.before, tt.after); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCapitalize(t *testing.T) {
+	for str, want := range map[string]string{"": "", "user": "User", "été": "Été", "ユーザ": "ユーザ"} {
+		if got := capitalize(str); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	for str, want := range map[string]string{"": "", "User": "user", "Été": "été", "ユーザ": "ユーザ"} {
+		if got := decapitalize(str); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestJSONFormat(t *testing.T) {
+	files := map[string]string{"user.txt": "user\n", "a.txt": "user\n", "b.txt": "nothing\n"}
+	dir := writeTree(t, files)
+	result := runCLI(t, dir, "", "-dry-run", "-format", "json", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("got exit code %d: %s", result.code, result.stderr)
+	}
+	var got []struct {
+		Path   string `json:"path"`
+		Diff   string `json:"diff"`
+		Rename *struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"rename"`
+	}
+	if err := json.Unmarshal([]byte(result.stdout), &got); err != nil {
+		t.Fatalf("%s: %q", err, result.stdout)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	if got[0].Path != "a.txt" || got[0].Diff != "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-user\n+member\n" || got[0].Rename != nil {
+		t.Errorf("got %+v", got[0])
+	}
+	if got[1].Path != "user.txt" || !strings.Contains(got[1].Diff, "+member\n") || got[1].Rename == nil || got[1].Rename.From != "user.txt" || got[1].Rename.To != "member.txt" {
+		t.Errorf("got %+v", got[1])
+	}
+	if tree := readTree(t, dir); !reflect.DeepEqual(tree, files) {
+		t.Errorf("got %v, want %v", tree, files)
+	}
+
+	if _, err := tryParseOptions(t, "-format", "json", "user", "member"); err == nil {
+		t.Error("-format=json without -dry-run is accepted")
+	}
+}
+
+// chdir changes the working dir during the test.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestExpandAncestorDirs(t *testing.T) {
+	root := writeTree(t, map[string]string{"base/a/b/c.txt": ""})
+	chdir(t, root)
+	abs := filepath.Join(root, "base")
+	want := []string{"a/b/c.txt", "a/b", "a"}
+	for _, baseDir := range []string{"base", "./base", "base/", abs, abs + "/", filepath.Join(root, "base", "a", "..")} {
+		t.Run(baseDir, func(t *testing.T) {
+			// The path is joined to the base dir as it's specified
+			path := filepath.Join(baseDir, "a", "b", "c.txt")
+			for _, p := range []string{path, filepath.Join(abs, "a", "b", "c.txt"), filepath.Join("base", "a", "b", "c.txt")} {
+				var got []string
+				for _, expanded := range expandAncestorDirs(baseDir, p) {
+					rel, err := filepath.Rel(abs, absPath(t, expanded))
+					if err != nil {
+						t.Fatal(err)
+					}
+					got = append(got, filepath.ToSlash(rel))
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s: got %v, want %v", p, got, want)
+				}
+			}
+		})
+	}
+
+	// A path outside the base dir is expanded to itself only
+	if got, want := expandAncestorDirs("base", filepath.Join(root, "other", "c.txt")), []string{filepath.Join(root, "other", "c.txt")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// absPath returns the absolute path of the path relative to the working dir.
+func absPath(t *testing.T, path string) string {
+	t.Helper()
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
+
+func TestEnvMode(t *testing.T) {
+	text := "# user settings\nUSER_NAME=user\nexport USER_ID = \"user-1\"\nuser.name=User\n"
+	want := "# member settings\nUSER_NAME=member\nexport USER_ID = \"member-1\"\nuser.name=Member\n"
+	for _, name := range []string{".env", ".env.local", "app.env"} {
+		if got := replaceString(t, name, text, "-env-mode", "user", "member"); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	// The keys are replaced in a file other than dotenv files or without -env-mode
+	all := "# member settings\nMEMBER_NAME=member\nexport MEMBER_ID = \"member-1\"\nmember.name=Member\n"
+	if got := replaceString(t, "env.txt", text, "-env-mode", "user", "member"); got != all {
+		t.Errorf("got %q, want %q", got, all)
+	}
+	if got := replaceString(t, ".env", text, "user", "member"); got != all {
+		t.Errorf("got %q, want %q", got, all)
+	}
+}
+
+func TestMinWordLength(t *testing.T) {
+	files := map[string]string{"a.txt": "id: valid\n"}
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+		want     string
+	}{
+		{
+			name:     "refused",
+			args:     []string{"-min-word-length", "3", "id", "key"},
+			wantCode: 1,
+			wantErr:  `ERROR: "Id" is shorter than 3 characters`,
+			want:     "id: valid\n",
+		},
+		{
+			name:    "forced",
+			args:    []string{"-min-word-length", "3", "-force", "id", "key"},
+			wantErr: `WARN: "Id" is shorter than 3 characters`,
+			want:    "key: valkey\n",
+		},
+		{
+			name: "long enough",
+			args: []string{"-min-word-length", "2", "id", "key"},
+			want: "key: valkey\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", tt.args...)
+			if result.code != tt.wantCode {
+				t.Errorf("exit code %d, want %d: %s", result.code, tt.wantCode, result.stderr)
+			}
+			if !strings.Contains(result.stderr, tt.wantErr) {
+				t.Errorf("stderr %q doesn't contain %q", result.stderr, tt.wantErr)
+			}
+			if got := readTree(t, dir)["a.txt"]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameScript(t *testing.T) {
+	discardOutput(t)
+	files := map[string]string{"user/user's.txt": "user\n", "user/a.txt": "a\n"}
+	dir := writeTree(t, files)
+	script := filepath.Join(t.TempDir(), "rename.sh")
+	opts := parseOptions(t, "-dir", dir, "-rename-script", script, "user", "member")
+	renames, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeRenameScript(script, renames); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("renamed: %v", got)
+	}
+	data, err := os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The leaf is renamed before its parent dir, with a quote escaped
+	want := fmt.Sprintf("#!/bin/sh\nset -e\nmv '%[1]s/user/user'\\''s.txt' '%[1]s/user/member'\\''s.txt'\nmv '%[1]s/user' '%[1]s/member'\n", dir)
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+
+	if out, err := exec.Command("sh", script).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want2 := map[string]string{"member/member's.txt": "user\n", "member/a.txt": "a\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want2) {
+		t.Errorf("got %v, want %v", got, want2)
+	}
+
+	// The renames under all the dirs matched by a glob are written to the script
+	dir = writeTree(t, map[string]string{"a/src/user.txt": "user\n", "b/src/user.txt": "user\n"})
+	result := runCLI(t, dir, "y\n", "-dir", "*/src", "-rename-script", script, "-rename-only", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	data, err = os.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "#!/bin/sh\nset -e\nmv 'a/src/user.txt' 'a/src/member.txt'\nmv 'b/src/user.txt' 'b/src/member.txt'\n"
+	if string(data) != want {
+		t.Errorf("got %q, want %q", data, want)
+	}
+}
+
+func TestJSONValuesOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		text string
+		want string
+	}{
+		{
+			name: "key and value",
+			path: "config.json",
+			text: "{\n  \"user\": \"user\",\n  \"userRole\" : [\"admin\", \"userAdmin\"],\n  \"nested\": {\"user\":\n    \"a \\\"user\\\"\"}\n}\n",
+			want: "{\n  \"user\": \"member\",\n  \"userRole\" : [\"admin\", \"memberAdmin\"],\n  \"nested\": {\"user\":\n    \"a \\\"member\\\"\"}\n}\n",
+		},
+		{
+			name: "invalid JSON",
+			path: "broken.json",
+			text: "{\"user\": \"user\"\n",
+			want: "{\"user\": \"user\"\n",
+		},
+		{
+			name: "not JSON file",
+			path: "config.yaml",
+			text: "{\"user\": \"user\"}\n",
+			want: "{\"member\": \"member\"}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, tt.path, tt.text, "-json-values-only", "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// gitApply applies the patch to the files in the dir with git apply.
+func gitApply(t *testing.T, dir string, patch string) {
+	t.Helper()
+	cmd := exec.Command("git", "apply", "-")
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(patch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git apply: %v: %s\n%s", err, out, patch)
+	}
+}
+
+func TestDiffAlgo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("user %d", i))
+	}
+	long := strings.Join(lines, "\n") + "\n"
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{name: "addition", a: "a\nb\n", b: "a\nb\nc\n"},
+		{name: "deletion", a: "a\nb\nc\n", b: "a\nc\n"},
+		{name: "scattered", a: long, b: strings.NewReplacer("user 2\n", "member 2\n", "user 18\n", "member 18\n").Replace(long)},
+		{name: "no-newline", a: "a\nuser", b: "a\nmember"},
+	}
+	for name, algo := range diffAlgorithms {
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				dir := writeTree(t, map[string]string{"a.txt": tt.a})
+				gitApply(t, dir, unifiedDiff("a.txt", tt.a, tt.b, algo))
+				if got := readTree(t, dir)["a.txt"]; got != tt.b {
+					t.Errorf("got %q, want %q", got, tt.b)
+				}
+			})
+		}
+	}
+
+	// The line algorithm makes a single hunk of the scattered changes
+	diff := unifiedDiff("a.txt", long, strings.NewReplacer("user 2\n", "member 2\n", "user 18\n", "member 18\n").Replace(long), diffAlgorithms["line"])
+	if n := len(hunkHeaderPattern.FindAllString(diff, -1)); n != 1 {
+		t.Errorf("got %d hunks:\n%s", n, diff)
+	}
+
+	if opts := parseOptions(t, "-diff-algo", "line", "user", "member"); opts.diffAlgo != "line" {
+		t.Errorf("got %q", opts.diffAlgo)
+	}
+	if _, err := tryParseOptions(t, "-diff-algo", "patience", "user", "member"); err == nil || err.Error() != "unknown diff algorithm: patience" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestAssertClean(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{
+			name: "protected region",
+			args: []string{"-skip-frontmatter"},
+			want: "---\nuser: user\n---\nmember\n",
+		},
+		{
+			name: "contained in replacement",
+			args: []string{"-literal", "user", "superuser"},
+			want: "---\nsuperuser: superuser\n---\nsuperuser\n",
+		},
+		{
+			name:     "remaining",
+			args:     []string{"-first-only"},
+			wantCode: 1,
+			want:     "---\nmember: user\n---\nuser\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, map[string]string{"a.md": "---\nuser: user\n---\nuser\n"})
+			args := append([]string{"-assert-clean"}, tt.args...)
+			if len(tt.args) < 3 {
+				args = append(args, "user", "member")
+			}
+			result := runCLI(t, dir, "y\n", args...)
+			if result.code != tt.wantCode {
+				t.Errorf("exit code %d, want %d: %s", result.code, tt.wantCode, result.stderr)
+			}
+			if tt.wantCode != 0 && !strings.Contains(result.stderr, "a.md: 2 words still remain") {
+				t.Errorf("stderr: %s", result.stderr)
+			}
+			if got := readTree(t, dir)["a.md"]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// writerFunc is an io.Writer calling the function on each write.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestStreamingOutput(t *testing.T) {
+	if _, err := exec.LookPath("mkfifo"); err != nil {
+		t.Skip("mkfifo is not found")
+	}
+	for _, jobs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, map[string]string{"f0.txt": "user\n", "f1.txt": "user\n", "f2.txt": "user\n"})
+			// The last file is a named pipe whose reading blocks until the first diff is printed,
+			// which never happens if the output is held until all the files are processed.
+			fifo := filepath.Join(dir, "f3.txt")
+			if out, err := exec.Command("mkfifo", fifo).CombinedOutput(); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+			var files []targetFile
+			for _, name := range []string{"f0.txt", "f1.txt", "f2.txt", "f3.txt"} {
+				files = append(files, targetFile{baseDir: dir, path: filepath.Join(dir, name)})
+			}
+
+			var writes []string
+			output = writerFunc(func(p []byte) (int, error) {
+				if len(writes) == 0 {
+					go func() {
+						_ = os.WriteFile(fifo, []byte("user\n"), 0644)
+					}()
+				}
+				writes = append(writes, string(p))
+				return len(p), nil
+			})
+			opts := parseOptions(t, "-dir", dir, "-dry-run", "-jobs", strconv.Itoa(jobs), "user", "member")
+			done := make(chan error, 1)
+			go func() {
+				_, _, err := replaceText(files, generateDictForText(opts.before, opts.after), opts)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(10 * time.Second):
+				// Unblock the reader not to leak it
+				_ = os.WriteFile(fifo, nil, 0644)
+				t.Fatal("no output before the last file is processed")
+			}
+
+			// Each file is printed by its own write in the order
+			if len(writes) != len(files) {
+				t.Fatalf("got %d writes: %q", len(writes), writes)
+			}
+			for i, w := range writes {
+				if !strings.Contains(w, fmt.Sprintf("f%d.txt\n", i)) {
+					t.Errorf("write %d: %q", i, w)
+				}
+			}
+		})
+	}
+}
+
+func TestRenameOnlyDryRun(t *testing.T) {
+	files := map[string]string{"user/user.txt": "user\n"}
+	dir := writeTree(t, files)
+	result := runCLI(t, dir, "", "-rename-only", "-dry-run", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if !strings.Contains(result.stdout, "Dry running only renames...\n>> Renaming files and dirs...\nuser/user.txt => user/member.txt\nuser => member\n") {
+		t.Errorf("no rename previews: %s", result.stdout)
+	}
+	for _, unexpected := range []string{">> Dictionary for text", ">> Replacing text", "@@"} {
+		if strings.Contains(result.stdout, unexpected) {
+			t.Errorf("unexpected %q: %s", unexpected, result.stdout)
+		}
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("changed: %v", got)
+	}
+}
+
+func TestGlobDir(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"services/user/src/user.txt":    "user\n",
+		"services/billing/src/user.txt": "user\n",
+		"services/src":                  "a file matching the pattern\n",
+		"services/user/README.md":       "user\n",
+	})
+	dirs, err := expandTargetDirs(filepath.Join(dir, "services", "*", "src"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "services/billing/src"), filepath.Join(dir, "services/user/src")}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("got %v, want %v", dirs, want)
+	}
+
+	for _, pattern := range []string{"services/*/lib", "services/*/src/user.txt"} {
+		if _, err := expandTargetDirs(filepath.Join(dir, pattern)); err == nil || !strings.HasPrefix(err.Error(), "no dirs match -dir: ") {
+			t.Errorf("%s: got %v", pattern, err)
+		}
+	}
+	if _, err := expandTargetDirs("services/[a"); err == nil || err.Error() != "invalid pattern for -dir: services/[a" {
+		t.Errorf("got %v", err)
+	}
+
+	// The matched dirs themselves are not renamed, and the files outside them are not changed
+	result := runCLI(t, dir, "y\n", "-dir", "services/*/src", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	wantTree := map[string]string{
+		"services/user/src/member.txt":    "member\n",
+		"services/billing/src/member.txt": "member\n",
+		"services/src":                    "a file matching the pattern\n",
+		"services/user/README.md":         "user\n",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, wantTree) {
+		t.Errorf("got %v, want %v", got, wantTree)
+	}
+	if result := runCLI(t, dir, "", "-dir", "services/*/lib", "user", "member"); result.code != 1 || !strings.Contains(result.stderr, "no dirs match -dir: services/*/lib") {
+		t.Errorf("got %d: %s", result.code, result.stderr)
+	}
+}
+
+func TestFilesFrom(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"a/user.txt": "user\n",
+		"b/user.txt": "user\n",
+		"c/user.txt": "user\n",
+		"user.bin":   "user\x00\n",
+	})
+	list := filepath.Join(t.TempDir(), "list.txt")
+	writeList := func(paths ...string) {
+		t.Helper()
+		if err := os.WriteFile(list, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths := func(files []targetFile) []string {
+		var found []string
+		for _, file := range files {
+			found = append(found, file.path)
+		}
+		return found
+	}
+	join := func(name string) string {
+		return filepath.Join(dir, filepath.FromSlash(name))
+	}
+
+	// Blank lines are ignored, and the paths are sorted
+	writeList("  "+join("c/user.txt")+" ", "", join("a/user.txt"), join("user.bin"))
+	files, err := readTargetFiles(list, parseOptions(t, "user", "member"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{join("a/user.txt"), join("c/user.txt"), join("user.bin")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	files, err = readTargetFiles(list, parseOptions(t, "-detect-binary", "user", "member"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := paths(files), []string{join("a/user.txt"), join("c/user.txt")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v with -detect-binary, want %v", got, want)
+	}
+
+	for _, tt := range []struct{ path, wantErr string }{
+		{path: join("missing.txt"), wantErr: "no such file or directory"},
+		{path: join("a"), wantErr: "not a file: " + join("a")},
+	} {
+		writeList(tt.path)
+		if _, err := readTargetFiles(list, parseOptions(t, "user", "member")); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: got %v", tt.path, err)
+		}
+	}
+
+	// Only the listed files are replaced and renamed
+	result := runCLI(t, dir, "a/user.txt\nc/user.txt\n", "-files-from", "-", "-dry-run", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	for _, want := range []string{"+++ b/a/user.txt\n", "+++ b/c/user.txt\n", "a/user.txt => a/member.txt\n", "c/user.txt => c/member.txt\n"} {
+		if !strings.Contains(result.stdout, want) {
+			t.Errorf("no %q: %s", want, result.stdout)
+		}
+	}
+	if strings.Contains(result.stdout, "b/user.txt") {
+		t.Errorf("an unlisted file is processed: %s", result.stdout)
+	}
+}
+
+func TestUnreadableFile(t *testing.T) {
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"a.txt": "user\n", "c.txt": "user\n"})
+	if err := os.Symlink("missing.txt", filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "c.txt"}
+	if os.Geteuid() != 0 {
+		// Root can read any file regardless of the permission
+		if err := os.WriteFile(filepath.Join(dir, "b2.txt"), []byte("user\n"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := parseOptions(t, "-dir", dir, "-outcomes", "user", "member")
+	files, err := findTargetFiles(dir, 0, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []string
+	for _, file := range files {
+		if file.skipped == "unreadable" {
+			skipped = append(skipped, filepath.Base(file.path))
+		}
+	}
+	wantSkipped := []string{"b.txt"}
+	if os.Geteuid() != 0 {
+		wantSkipped = append(wantSkipped, "b2.txt")
+	}
+	if !reflect.DeepEqual(skipped, wantSkipped) {
+		t.Errorf("got skipped %v, want %v", skipped, wantSkipped)
+	}
+	if got := relativePaths(t, dir, unskippedFiles(files)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := findTargetFiles(dir, 0, parseOptions(t, "-dir", dir, "-strict", "user", "member")); err == nil {
+		t.Error("no error with -strict")
+	}
+}
+
+func TestCommentsOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		text string
+		want string
+	}{
+		{
+			name: "line comment",
+			path: "user.go",
+			text: "// User is a user.\ntype User struct{} // the user\n",
+			want: "// Member is a member.\ntype User struct{} // the member\n",
+		},
+		{
+			name: "block comment",
+			path: "user.ts",
+			text: "/*\n * user\n */\nconst user = 1; /* user */\n",
+			want: "/*\n * member\n */\nconst user = 1; /* member */\n",
+		},
+		{
+			name: "comment markers in strings",
+			path: "user.go",
+			text: "url := \"http://user\" // user\nsql := `/* user */`\nr := '/' // user\n",
+			want: "url := \"http://user\" // member\nsql := `/* user */`\nr := '/' // member\n",
+		},
+		{
+			name: "hash comment",
+			path: "user.py",
+			text: "# user\nuser = \"#user\"  # user\n",
+			want: "# member\nuser = \"#user\"  # member\n",
+		},
+		{
+			name: "CSS",
+			path: "user.css",
+			text: "/* user */\n.user { }\n",
+			want: "/* member */\n.user { }\n",
+		},
+		{
+			name: "Makefile",
+			path: "build/Makefile",
+			text: "# user\nuser:\n",
+			want: "# member\nuser:\n",
+		},
+		{
+			name: "unknown syntax",
+			path: "user.txt",
+			text: "// user\n# user\n",
+			want: "// user\n# user\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, tt.path, tt.text, "-comments-only", "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{input: "y\n", want: true},
+		{input: "Y\n", want: true},
+		{input: " y \r\n", want: true},
+		{input: "y", want: true},
+		{input: "n\n", want: false},
+		{input: "yes\n", want: false},
+		{input: "\n", want: false},
+		{input: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Quote(tt.input), func(t *testing.T) {
+			var out bytes.Buffer
+			if got := confirm(strings.NewReader(tt.input), &out, "Sure?"); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if out.String() != "Sure? [y/N]: " {
+				t.Errorf("got prompt %q", out.String())
+			}
+		})
+	}
+
+	// The rest of a buffered input is left for the next confirmation
+	in := bufio.NewReader(strings.NewReader("y\nn\n"))
+	if !confirm(in, io.Discard, "First?") || confirm(in, io.Discard, "Second?") {
+		t.Error("the answers are not read line by line")
+	}
+
+	dir := writeTree(t, map[string]string{"a.txt": "user\n"})
+	result := runCLI(t, dir, "n\n", "-prompt", "Rename users?", "user", "member")
+	if result.code != 0 || !strings.Contains(result.stdout, "Rename users? [y/N]: Cancelled.\n") {
+		t.Errorf("got %d: %s", result.code, result.stdout)
+	}
+	if got := readTree(t, dir)["a.txt"]; got != "user\n" {
+		t.Errorf("replaced after cancelled: %q", got)
+	}
+}
+
+func TestMaxDiffLines(t *testing.T) {
+	before := strings.Repeat("user\n", 10)
+	after := strings.Repeat("member\n", 10)
+	diff := unifiedDiff("a.txt", before, after, diffAlgorithms["myers"])
+	// 3 header lines and 20 changed lines
+	if n := strings.Count(diff, "\n"); n != 23 {
+		t.Fatalf("got %d lines:\n%s", n, diff)
+	}
+	tests := []struct {
+		max  int
+		want string
+	}{
+		{max: 5, want: "--- a/a.txt\n+++ b/a.txt\n@@ -1,10 +1,10 @@\n-user\n-user\n... (18 more lines)\n"},
+		{max: 22, want: strings.TrimSuffix(diff, "+member\n") + "... (1 more lines)\n"},
+		{max: 23, want: diff},
+		{max: 0, want: diff},
+	}
+	for _, tt := range tests {
+		if got := truncateDiff(diff, tt.max); got != tt.want {
+			t.Errorf("%d: got %q, want %q", tt.max, got, tt.want)
+		}
+	}
+
+	// Only the shown diff is truncated
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"a.txt": before})
+	opts := parseOptions(t, "-dir", dir, "-dry-run", "-max-diff-lines", "5", "user", "member")
+	result, err := replaceFile(targetFile{baseDir: dir, path: filepath.Join(dir, "a.txt")}, generateDictForText(opts.before, opts.after), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(result.output, "-user\n-user\n... (18 more lines)\n") {
+		t.Errorf("got output %q", result.output)
+	}
+	if strings.Count(result.diff, "\n") != 23 {
+		t.Errorf("got diff %q", result.diff)
+	}
+}
+
+func TestTextExtensions(t *testing.T) {
+	// A NUL byte makes the content sniffed as binary
+	files := map[string]string{
+		"user.tmpl":   "{{ .user }}\x00\n",
+		"user.TMPL":   "{{ .user }}\x00\n",
+		"user.proto":  "message User {}\x00\n",
+		"tmpl":        "user\x00\n",
+		"user.tmpl.x": "user\x00\n",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "sniffed", want: nil},
+		{name: "with dot", args: []string{"-text-extensions", ".tmpl"}, want: []string{"user.TMPL", "user.tmpl"}},
+		{name: "without dot", args: []string{"-text-extensions", "tmpl,proto"}, want: []string{"user.TMPL", "user.proto", "user.tmpl"}},
+		{name: "repeated", args: []string{"-text-extensions", ".tmpl", "-text-extensions", ".proto"}, want: []string{"user.TMPL", "user.proto", "user.tmpl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			targets := textFiles(findTargets(t, dir, opts))
+			if got := relativePaths(t, dir, targets); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if _, _, err := replaceText(targets, generateDictForText(opts.before, opts.after), opts); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := readTree(t, dir)["user.tmpl"] == "{{ .member }}\x00\n", len(tt.want) > 0; got != want {
+				t.Errorf("got replaced %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPreserveAlignment(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		text          string
+		want          string
+	}{
+		{
+			name: "key-value",
+			text: "user_name:   a\nuser_id:     b\nlocale:      c\n",
+			want: "member_name: a\nmember_id:   b\nlocale:      c\n",
+		},
+		{
+			name: "table",
+			text: "| id | user    | role  |\n|----|---------|-------|\n| 1  | user    | admin |\n",
+			want: "| id | member  | role  |\n|----|---------|-------|\n| 1  | member  | admin |\n",
+		},
+		{
+			name:   "shorter",
+			before: "member", after: "user",
+			text: "member:  x\nother:   y\n",
+			want: "user:    x\nother:   y\n",
+		},
+		{
+			name: "overflow",
+			text: "user  = 1\nab    = 2\n",
+			want: "member = 1\nab    = 2\n",
+		},
+		{
+			name: "not aligned",
+			text: "a user b\n",
+			want: "a member b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := tt.before, tt.after
+			if before == "" {
+				before, after = "user", "member"
+			}
+			if got := replaceString(t, "a.txt", tt.text, "-preserve-alignment", before, after); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstOnly(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		words []string
+		text  string
+		want  string
+	}{
+		{
+			name:  "each form",
+			words: []string{"user-profile", "member-account"},
+			text:  "user_profile: UserProfile\nuser_profile: UserProfile\n",
+			want:  "member_account: MemberAccount\nuser_profile: UserProfile\n",
+		},
+		{
+			// The forms sharing the same word are replaced only once in total
+			name: "same word",
+			text: "user_id: user\nuser\n",
+			want: "member_id: user\nuser\n",
+		},
+		{
+			name: "prose",
+			args: []string{"-prose"},
+			text: "users and user, user.\n",
+			want: "users and member, user.\n",
+		},
+		{
+			// The first occurrence is counted across the regions of a file
+			name: "regions",
+			args: []string{"-region-start", "BEGIN", "-region-end", "END"},
+			text: "user\nBEGIN\nuser\nEND\nBEGIN\nuser\nEND\n",
+			want: "user\nBEGIN\nmember\nEND\nBEGIN\nuser\nEND\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			words := tt.words
+			if words == nil {
+				words = []string{"user", "member"}
+			}
+			args := append(append([]string{"-first-only"}, tt.args...), words...)
+			if got := replaceString(t, "a.txt", tt.text, args...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The first occurrences are replaced in each file
+	opts := parseOptions(t, "-first-only", "user", "member")
+	d := generateDictForText(opts.before, opts.after)
+	for i := 0; i < 2; i++ {
+		if got, n := replaceContent("a.txt", "user user\n", d, opts); got != "member user\n" || n != 1 {
+			t.Errorf("file %d: got %q with %d replacements", i, got, n)
+		}
+	}
+}
+
+func TestRenameSeparator(t *testing.T) {
+	files := map[string]string{
+		"user-profile.txt": "",
+		"user_profile.md":  "",
+		"USER-PROFILE":     "",
+		"UserProfile.go":   "",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "underscore",
+			args: []string{"-rename-separator", "_"},
+			want: map[string]string{
+				"member_account.txt": "",
+				"member_account.md":  "",
+				"MEMBER_ACCOUNT":     "",
+				"MemberAccount.go":   "",
+			},
+		},
+		{
+			name: "normalize-sep",
+			args: []string{"-normalize-sep", "-"},
+			want: map[string]string{
+				"member-account.txt": "",
+				"member-account.md":  "",
+				"MEMBER-ACCOUNT":     "",
+				"MemberAccount.go":   "",
+			},
+		},
+		{
+			name: "default",
+			want: map[string]string{
+				"member-account.txt": "",
+				"member_account.md":  "",
+				"MEMBER-ACCOUNT":     "",
+				"MemberAccount.go":   "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(tt.args, "user-profile", "member-account")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := tryParseOptions(t, "-rename-separator", "/", "user", "member"); err == nil || !strings.Contains(err.Error(), `invalid separator: "/"`) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestFindOverlap(t *testing.T) {
+	d := dict{items: []dictItem{{before: "user", after: "member"}, {before: "username", after: "login"}, {before: "name", after: "title"}}}
+	tests := []struct {
+		line string
+		a, b string
+		ok   bool
+	}{
+		{line: "username", a: "user", b: "username", ok: true},
+		{line: "user name", ok: false},
+		{line: "user, user", ok: false},
+		{line: "a name and a username", a: "user", b: "username", ok: true},
+		{line: "", ok: false},
+	}
+	for _, tt := range tests {
+		a, b, ok := findOverlap(tt.line, d)
+		if a != tt.a || b != tt.b || ok != tt.ok {
+			t.Errorf("%q: got %q, %q, %v, want %q, %q, %v", tt.line, a, b, ok, tt.a, tt.b, tt.ok)
+		}
+	}
+
+	// The line numbers of the changed lines are reported
+	dir := writeTree(t, map[string]string{"a.txt": "user\nusername\nuser name\nusername\n", "dict.tsv": "username\tlogin\nuser\tmember\n"})
+	result := runCLI(t, dir, "", "-dry-run", "-dict-file", "dict.tsv", "-exclude", "dict.tsv")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := "WARN: a.txt:2: replacements of \"username\" and \"user\" overlap\nWARN: a.txt:4: replacements of \"username\" and \"user\" overlap\n"
+	if !strings.Contains(result.stderr, want) || strings.Count(result.stderr, "overlap") != 2 {
+		t.Errorf("got %q, want %q", result.stderr, want)
+	}
+}
+
+func TestSmartCase(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		text string
+		want string
+	}{
+		{name: "lower", text: "foo\n", want: "bar\n"},
+		{name: "Title", text: "Foo\n", want: "Bar\n"},
+		{name: "UPPER", text: "FOO\n", want: "BAR\n"},
+		// A casing other than the three takes the after word of the first form as is
+		{name: "mixed", text: "fOo\n", want: "Bar\n"},
+		{name: "in words", text: "fooBar FooBar FOO_BAR\n", want: "barBar BarBar BAR_BAR\n"},
+		{name: "multiple words", args: []string{"foo-bar", "baz-qux"}, text: "Foo bar, FOO-BAR, foobar\n", want: "Baz qux, BAZ-QUX, bazqux\n"},
+		{name: "exact form", args: []string{"foo-bar", "baz-qux"}, text: "FooBar fooBar FOOBAR\n", want: "BazQux bazQux BAZQUX\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if args == nil {
+				args = []string{"foo", "bar"}
+			}
+			if got := replaceString(t, "a.txt", tt.text, append([]string{"-smart-case"}, args...)...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceFunc(t *testing.T) {
+	prev := replaceFunc
+	t.Cleanup(func() {
+		replaceFunc = prev
+	})
+	var forms []string
+	replaceFunc = func(form, before, after string) string {
+		forms = append(forms, form)
+		return strings.ToUpper(after)
+	}
+
+	if got, want := replaceString(t, "a.txt", "user-profile userProfile\n", "user-profile", "account-name"), "ACCOUNT-NAME ACCOUNTNAME\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if len(forms) == 0 || forms[0] != "upper-camel" {
+		t.Errorf("got forms %q, want them to start with upper-camel", forms)
+	}
+
+	// The whole words of -prose are post-processed as well
+	if got, want := replaceString(t, "a.txt", "user\n", "-prose", "user", "account"), "ACCOUNT\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	opts := parseOptions(t, "user-profile", "account-name")
+	if got, want := replaceFileName("user_profile.go", generateDictForFileName(opts.before, opts.after), opts), "ACCOUNT_NAME.go"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestIncludeName(t *testing.T) {
+	files := map[string]string{
+		"Dockerfile":           "FROM user\n",
+		"docker/Dockerfile":    "FROM user\n",
+		"Dockerfile.dev":       "FROM user\n",
+		"Makefile":             "user:\n",
+		"LICENSE":              "user\n",
+		"main.go":              "package user\n",
+		"docs/user-guide.html": "user\n",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "name only",
+			args: []string{"-include-name", "Dockerfile"},
+			want: []string{"Dockerfile", "docker/Dockerfile"},
+		},
+		{
+			name: "with include",
+			args: []string{"-include", "*.go", "-include-name", "Dockerfile,Makefile"},
+			want: []string{"Dockerfile", "Makefile", "docker/Dockerfile", "main.go"},
+		},
+		{
+			name: "excluded",
+			args: []string{"-include-name", "Dockerfile", "-exclude", "docker"},
+			want: []string{"Dockerfile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, files)
+			opts := parseOptions(t, append(append([]string{"-dir", dir}, tt.args...), "user", "member")...)
+			if got := relativePaths(t, dir, textFiles(findTargets(t, dir, opts))); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// wideTree returns a tree of many sibling dirs, each of which has nested dirs and files to be renamed.
+func wideTree(width int) map[string]string {
+	files := map[string]string{}
+	for i := 0; i < width; i++ {
+		for j := 0; j < 3; j++ {
+			files[fmt.Sprintf("user-%02d/user/user-%d.txt", i, j)] = ""
+		}
+		files[fmt.Sprintf("user-%02d/a.txt", i)] = ""
+	}
+	return files
+}
+
+func TestRenameConcurrently(t *testing.T) {
+	want := map[string]string{}
+	for path := range wideTree(50) {
+		want[strings.ReplaceAll(path, "user", "member")] = ""
+	}
+	for _, jobs := range []int{1, 2, 8, 64} {
+		t.Run(fmt.Sprintf("jobs=%d", jobs), func(t *testing.T) {
+			discardOutput(t)
+			dir := writeTree(t, wideTree(50))
+			opts := parseOptions(t, "-dir", dir, "-jobs", strconv.Itoa(jobs), "user", "member")
+			renames, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 3 files and 2 dirs in each of the sibling dirs
+			if len(renames) != 50*5 {
+				t.Errorf("got %d renames", len(renames))
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestRenameConcurrentlyFailure(t *testing.T) {
+	// A file can't be renamed to an existing non-empty dir
+	files := map[string]string{"a/user/user.txt": "", "a/user/member.txt/x": "", "b/user/user.txt": ""}
+	renames := []renameResult{
+		{From: "b/user/user.txt", To: "b/user/member.txt"},
+		{From: "b/user", To: "b/member"},
+		{From: "a/user/user.txt", To: "a/user/member.txt"},
+		{From: "a/user", To: "a/member"},
+	}
+	relocate := func(dir string) []renameResult {
+		var located []renameResult
+		for _, rename := range renames {
+			located = append(located, renameResult{From: filepath.Join(dir, rename.From), To: filepath.Join(dir, rename.To)})
+		}
+		return located
+	}
+
+	// The ancestor of the failed rename is renamed as well in -keep-going mode
+	dir := writeTree(t, files)
+	errs, err := renameConcurrently(relocate(dir), 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs[0] != nil || errs[1] != nil || errs[2] == nil || errs[3] != nil {
+		t.Errorf("got %v", errs)
+	}
+	want := map[string]string{"a/member/user.txt": "", "a/member/member.txt/x": "", "b/member/member.txt": ""}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Otherwise, the ancestor of the failed rename is left as is
+	dir = writeTree(t, files)
+	if _, err := renameConcurrently(relocate(dir), 4, false); err == nil || !strings.Contains(err.Error(), "failed to rename") {
+		t.Errorf("got %v", err)
+	}
+	if got := readTree(t, dir); got["a/user/user.txt"] != "" || got["a/user/member.txt/x"] != "" {
+		t.Errorf("got %v", got)
+	}
+}
+
+func BenchmarkRenameConcurrently(b *testing.B) {
+	for _, jobs := range []int{1, 8} {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := b.TempDir()
+				for name := range wideTree(100) {
+					path := filepath.Join(dir, filepath.FromSlash(name))
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						b.Fatal(err)
+					}
+					if err := os.WriteFile(path, nil, 0644); err != nil {
+						b.Fatal(err)
+					}
+				}
+				var renames []renameResult
+				err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+					if err == nil && path != dir && strings.Contains(d.Name(), "user") {
+						renames = append(renames, renameResult{From: path, To: filepath.Join(filepath.Dir(path), strings.ReplaceAll(d.Name(), "user", "member"))})
+					}
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+				// From leaf to root like renameFilesAndDirs
+				sort.Slice(renames, func(i, j int) bool {
+					return renames[i].From > renames[j].From
+				})
+				b.StartTimer()
+				if _, err := renameConcurrently(renames, jobs, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDoubleUnderscores(t *testing.T) {
+	befores := map[string]string{}
+	for _, it := range generateDictForFileName("page-user__profile", "page-member__account").items {
+		befores[it.form] = it.before
+	}
+	for form, want := range map[string]string{
+		"upper-camel": "PageUser__profile",
+		"lower-camel": "pageUser__profile",
+		"snake":       "page_user__profile",
+		"kebab":       "page-user__profile",
+		"flat":        "pageuser__profile",
+		"upper-flat":  "PAGEUSER__PROFILE",
+	} {
+		if got := befores[form]; got != want {
+			t.Errorf("%s: got %q, want %q", form, got, want)
+		}
+	}
+
+	if got, want := noSign("user__profile-page"), "user__profilepage"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The segment markers are kept in both the text and the file names
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"user__profile__page.html": "<a href=\"user__profile__page.html\">user__profile</a>\n"})
+	opts := parseOptions(t, "-dir", dir, "user__profile", "member__account")
+	targets := textFiles(findTargets(t, dir, opts))
+	if _, _, err := replaceText(targets, generateDictForText(opts.before, opts.after), opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renameFilesAndDirs(dir, targets, generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"member__account__page.html": "<a href=\"member__account__page.html\">member__account</a>\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	dir := writeTree(t, map[string]string{"user/user.txt": "user\n"})
+	if err := os.Symlink("missing", filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	result := runCLI(t, dir, "", "-log-format", "json", "-dry-run", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	// Only the diffs are printed to stdout
+	if want := "--- a/user/user.txt\n+++ b/user/user.txt\n@@ -1 +1 @@\n-user\n+member\n\n"; result.stdout != want {
+		t.Errorf("got stdout %q, want %q", result.stdout, want)
+	}
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSuffix(result.stderr, "\n"), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		delete(record, "time")
+		delete(record, "items")
+		records = append(records, record)
+	}
+	for _, want := range []map[string]interface{}{
+		{"level": "INFO", "msg": "target file", "path": "user/user.txt"},
+		{"level": "INFO", "msg": "dictionary", "kind": "text"},
+		{"level": "INFO", "msg": "replace", "path": "user/user.txt", "replacements": float64(1)},
+		{"level": "INFO", "msg": "rename", "from": "user/user.txt", "to": "user/member.txt"},
+		{"level": "INFO", "msg": "rename", "from": "user", "to": "member"},
+	} {
+		var found bool
+		for _, record := range records {
+			found = found || reflect.DeepEqual(record, want)
+		}
+		if !found {
+			t.Errorf("no record %v in %v", want, records)
+		}
+	}
+	var warned bool
+	for _, record := range records {
+		warned = warned || record["level"] == "WARN" && strings.HasPrefix(record["msg"].(string), "skipped unreadable file: ")
+	}
+	if !warned {
+		t.Errorf("no warning in %v", records)
+	}
+
+	result = runCLI(t, dir, "", "-log-format", "text", "-dry-run", "user", "member")
+	if !strings.Contains(result.stderr, "level=INFO msg=rename from=user/user.txt to=user/member.txt\n") {
+		t.Errorf("got stderr %q", result.stderr)
+	}
+	if _, err := tryParseOptions(t, "-log-format", "xml", "user", "member"); err == nil || err.Error() != "unknown log format: xml" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCollisionSuffix(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  map[string]string
+	}{
+		{
+			name:  "existing files",
+			files: map[string]string{"user.go": "1", "member.go": "2", "member-2.go": "3"},
+			want:  map[string]string{"member-3.go": "1", "member.go": "2", "member-2.go": "3"},
+		},
+		{
+			// The number is appended to the whole name of a dir
+			name:  "existing dir",
+			files: map[string]string{"user.d/a": "1", "member.d/a": "2"},
+			want:  map[string]string{"member.d-2/a": "1", "member.d/a": "2"},
+		},
+		{
+			name:  "planned destinations",
+			files: map[string]string{"user.txt": "1", "client.txt": "2", "dict.tsv": "user\tmember\nclient\tmember\n"},
+			args:  []string{"-dict-file", "dict.tsv", "-exclude", "dict.tsv"},
+			want:  map[string]string{"member.txt": "1", "member-2.txt": "2", "dict.tsv": "user\tmember\nclient\tmember\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, tt.files)
+			args := append([]string{"-collision-suffix", "-rename-only"}, tt.args...)
+			if tt.args == nil {
+				args = append(args, "user", "member")
+			}
+			result := runCLI(t, dir, "y\n", args...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if !strings.Contains(result.stderr, "already exists, so it's renamed to") {
+				t.Errorf("no warning: %s", result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferencePattern(t *testing.T) {
+	tests := []struct {
+		path    string
+		matches []string
+		others  []string
+	}{
+		{
+			path:    "src/user_profile.go",
+			matches: []string{"UserProfile", "user-profile", "USER_PROFILE", "user.profile", "user/profile", "User Profile", "userprofile"},
+			others:  []string{"user__profile", "user", "profile_user"},
+		},
+		{
+			path:    "UserProfile.tsx",
+			matches: []string{"user_profile", "userProfile"},
+			others:  []string{"User", "Profile"},
+		},
+		{
+			path:    "v2API.txt",
+			matches: []string{"v2_api", "V2Api"},
+		},
+	}
+	for _, tt := range tests {
+		pattern := referencePattern(tt.path)
+		for _, s := range tt.matches {
+			if !pattern.MatchString(s) {
+				t.Errorf("%s: %q is not matched by %s", tt.path, s, pattern)
+			}
+		}
+		for _, s := range tt.others {
+			if pattern.MatchString(s) {
+				t.Errorf("%s: %q is matched by %s", tt.path, s, pattern)
+			}
+		}
+	}
+	if pattern := referencePattern("_.txt"); pattern != nil {
+		t.Errorf("got %s", pattern)
+	}
+
+	dir := writeTree(t, map[string]string{
+		"user_profile.go": "package main\n",
+		"main.go":         "// see UserProfile\n",
+		"README.md":       "nothing\n",
+	})
+	result := runCLI(t, dir, "y\n", "-rename-only", "-check-references", "user-profile", "member-account")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if want := "WARN: main.go: still refers to user_profile.go renamed to member_account.go\n"; result.stderr != want {
+		t.Errorf("got %q, want %q", result.stderr, want)
+	}
+}
+
+func TestTwoPass(t *testing.T) {
+	swap := generateDictForText("user-id", "group-key")
+	swap.items = append(swap.items, generateDictForText("group-key", "user-id").items...)
+	text := "UserId groupKey USER_ID group-key user id, Group key\n"
+	want := "GroupKey userId GROUP_KEY user-id group key, User id\n"
+
+	opts := parseOptions(t, "-two-pass", "user-id", "group-key")
+	got, count := replaceContent("a.txt", text, swap, opts)
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if count != 6 {
+		t.Errorf("got %d replacements", count)
+	}
+
+	// Sequential replacement turns both into one of them
+	if got, _ := replaceContent("a.txt", text, swap, parseOptions(t, "user-id", "group-key")); got == want {
+		t.Errorf("swapped without -two-pass: %q", got)
+	}
+
+	// A text containing the placeholder characters is kept as is
+	if got, _ := replaceContent("a.txt", "\uE000user-id\uE001\n", swap, opts); got != "\uE000group-key\uE001\n" {
+		t.Errorf("got %q", got)
+	}
+
+	for _, flag := range []string{"-prose", "-first-only", "-smart-case"} {
+		if _, err := tryParseOptions(t, "-two-pass", flag, "user", "member"); err == nil {
+			t.Errorf("%s is accepted with -two-pass", flag)
+		}
+	}
+}
+
+func TestDiffDir(t *testing.T) {
+	files := map[string]string{"src/user.txt": "user\n", "a.txt": "nothing\n"}
+	dir := writeTree(t, files)
+	diffDir := filepath.Join(t.TempDir(), "diff")
+	result := runCLI(t, dir, "", "-dry-run", "-diff-dir", diffDir, "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	// Only the changed files are written, and the files are not changed in a dry run
+	want := map[string]string{"before/src/user.txt": "user\n", "after/src/user.txt": "member\n"}
+	if got := readTree(t, diffDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("got %v, want %v", got, files)
+	}
+
+	// A file outside of the base dir is placed by its absolute path under the diff dir
+	outside := writeTree(t, map[string]string{"user.txt": "user\n"})
+	diffDir = t.TempDir()
+	rel, err := filepath.Rel(dir, filepath.Join(outside, "user.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDiffCopies(diffDir, dir, targetFile{baseDir: dir, path: filepath.Join(dir, rel)}, "user\n", "member\n"); err != nil {
+		t.Fatal(err)
+	}
+	abs := strings.TrimPrefix(filepath.ToSlash(filepath.Join(outside, "user.txt")), "/")
+	want = map[string]string{"before/" + abs: "user\n", "after/" + abs: "member\n"}
+	if got := readTree(t, diffDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	chdir(t, dir)
+	if err := writeDiffCopies(diffDir, ".", targetFile{baseDir: ".", path: rel}, "user\n", "member\n"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, diffDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v with a relative path, want %v", got, want)
+	}
+
+	// The same file in the dirs matched by a glob is placed by the paths relative to their common dir
+	dir = writeTree(t, map[string]string{"services/a/src/user.txt": "user\n", "services/b/src/user.txt": "user\n"})
+	diffDir = filepath.Join(t.TempDir(), "diff")
+	result = runCLI(t, dir, "", "-dry-run", "-diff-dir", diffDir, "-dir", "services/*/src", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want = map[string]string{
+		"before/a/src/user.txt": "user\n", "after/a/src/user.txt": "member\n",
+		"before/b/src/user.txt": "user\n", "after/b/src/user.txt": "member\n",
+	}
+	if got := readTree(t, diffDir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestDescribeCollisions(t *testing.T) {
+	noColor := color.NoColor
+	t.Cleanup(func() {
+		color.NoColor = noColor
+	})
+	color.NoColor = true
+	got := generateDictForFileName("user", "member").describe(false)
+	want := `"User" => "Member"
+"user" => "member"
+"USER" => "MEMBER"
+"user" => "member"
+"USER" => "MEMBER"
+"user" => "member"
+"USER" => "MEMBER"
+"user" => "member"
+WARN: dictionary is ambiguous
+  lower-camel, snake, kebab and flat collide: "user" => "member"
+  screaming-snake, screaming-kebab and upper-flat collide: "USER" => "MEMBER"
+HINT: It may cause unexpected result. You'd better add another word at least.`
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// The forms of two words never collide
+	if got := generateDictForText("user-profile", "member-account").String(); strings.Contains(got, "WARN") {
+		t.Errorf("got\n%s", got)
+	}
+	if got := generateDictForFileName("user-profile", "member-account").String(); strings.Contains(got, "WARN") {
+		t.Errorf("got\n%s", got)
+	}
+
+	// Only the two forms are named
+	d := dict{items: []dictItem{{form: "snake", before: "a_b", after: "c_d"}, {form: "kebab", before: "a-b", after: "c-d"}, {form: "custom", before: "a_b", after: "c_d"}}}
+	if got := d.String(); !strings.Contains(got, "\n  snake and custom collide: \"a_b\" => \"c_d\"\n") {
+		t.Errorf("got\n%s", got)
+	}
+}
+
+func TestFormLabels(t *testing.T) {
+	type labeled struct{ form, before string }
+	var got []labeled
+	for _, it := range generateDictForText("user-profile", "member-account").items {
+		got = append(got, labeled{it.form, it.before})
+	}
+	want := []labeled{
+		{"upper-camel", "UserProfile"},
+		{"lower-camel", "userProfile"},
+		{"screaming-snake", "USER_PROFILE"},
+		{"snake", "user_profile"},
+		{"screaming-kebab", "USER-PROFILE"},
+		{"kebab", "user-profile"},
+		{"upper-flat", "USERPROFILE"},
+		{"flat", "userprofile"},
+		{"upper-space", "User Profile"},
+		{"capitalized-space", "User profile"},
+		{"lower-space", "user profile"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The dictionary for file names has the forms without spaces
+	fileNameDict := generateDictForFileName("user-profile", "member-account")
+	if !reflect.DeepEqual(fileNameDict.items, generateDictForText("user-profile", "member-account").items[:8]) {
+		t.Errorf("got %v", fileNameDict.items)
+	}
+
+	lines := strings.Split(fileNameDict.describe(true), "\n")
+	if lines[0] != `"UserProfile" => "MemberAccount" (upper-camel)` || lines[7] != `"userprofile" => "memberaccount" (flat)` {
+		t.Errorf("got %q", lines)
+	}
+	if got := fileNameDict.describe(false); strings.Contains(got, "(") {
+		t.Errorf("labeled without -show-forms: %q", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "user\n", "build/": ""})
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The after word contains the before word, which must not be replaced again in the files written by the watch itself.
+	// -two-pass keeps the identical before words of the forms from replacing it again within a run.
+	cmd := exec.Command(exe, "-watch", "-two-pass", "user", "superuser")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), mainEnv+"=1")
+	cmd.Stdin = strings.NewReader("y\n")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	// The changes are watched after the initial run
+	watching := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if scanner.Text() == ">> Watching for changes..." {
+				close(watching)
+				break
+			}
+		}
+		_, _ = io.Copy(io.Discard, stdout)
+	}()
+	select {
+	case <-watching:
+	case <-time.After(10 * time.Second):
+		t.Fatal("not watching")
+	}
+	if got := readTree(t, dir)["a.txt"]; got != "superuser\n" {
+		t.Fatalf("not replaced in the initial run: %q", got)
+	}
+
+	// A file added in a new dir is processed, while one in an ignored dir is not
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The new dir may be watched only after the event of its creation is handled
+	time.Sleep(100 * time.Millisecond)
+	// A top-level file is reported relative to the default -dir "." as "./d.txt"
+	for _, name := range []string{"sub/b.txt", "build/c.txt", "d.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte("user\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for tree := readTree(t, dir); tree["sub/b.txt"] != "superuser\n" || tree["d.txt"] != "superuser\n"; tree = readTree(t, dir) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the new files are not processed: %v", tree)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	// The writes of the watch itself would be processed after the debounce
+	time.Sleep(4 * watchDebounce)
+	tree := readTree(t, dir)
+	for _, name := range []string{"a.txt", "sub/b.txt", "d.txt"} {
+		if got := tree[name]; got != "superuser\n" {
+			t.Errorf("%s is replaced again: %q", name, got)
+		}
+	}
+	if got := tree["build/c.txt"]; got != "user\n" {
+		t.Errorf("processed in the ignored dir: %q", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	files := map[string]string{"user/user.txt": "user\n", "a.txt": "user\n", "b.txt": "nothing\n"}
+	dir := writeTree(t, files)
+	result := runCLI(t, dir, "", "-check", "user", "member")
+	if result.code != 1 {
+		t.Errorf("got exit code %d: %s", result.code, result.stderr)
+	}
+	// Both the files to be replaced and renamed are listed once
+	if want := "a.txt\nuser\nuser/user.txt\n"; result.stdout != want {
+		t.Errorf("got %q, want %q", result.stdout, want)
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("changed: %v", got)
+	}
+
+	result = runCLI(t, dir, "", "-check", "group", "team")
+	if result.code != 0 || result.stdout != "" {
+		t.Errorf("got exit code %d: %q", result.code, result.stdout)
+	}
+
+	for _, args := range [][]string{{"-format", "json"}, {"-watch"}} {
+		if _, err := tryParseOptions(t, append(append([]string{"-check"}, args...), "user", "member")...); err == nil {
+			t.Errorf("%v is accepted with -check", args)
+		}
+	}
+}
+
+func TestRegions(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "inside and outside",
+			text: "user\n# BEGIN user\nuser\nuser\n# END user\nuser\n",
+			want: "user\n# BEGIN user\nmember\nmember\n# END user\nuser\n",
+		},
+		{
+			name: "multiple regions",
+			text: "# BEGIN\nuser\n# END\nuser\n# BEGIN\nuser\n# END\n",
+			want: "# BEGIN\nmember\n# END\nuser\n# BEGIN\nmember\n# END\n",
+		},
+		{
+			// The region continues to the end of the text without the end marker
+			name: "unclosed",
+			text: "user\n# BEGIN\nuser\n",
+			want: "user\n# BEGIN\nmember\n",
+		},
+		{
+			name: "end marker only",
+			text: "user\n# END\nuser\n",
+			want: "user\n# END\nuser\n",
+		},
+		{
+			name: "start marker at the end",
+			text: "user\n# BEGIN",
+			want: "user\n# BEGIN",
+		},
+		{
+			name: "no region",
+			text: "user\n",
+			want: "user\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, "a.txt", tt.text, "-region-start", "# BEGIN", "-region-end", "# END", "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The generated blocks are replaced with the default markers
+	text := "type User struct{}\n// BEGIN GENERATED\nfunc (User) user() {}\n// END GENERATED\nvar user User\n"
+	want := "type User struct{}\n// BEGIN GENERATED\nfunc (Member) member() {}\n// END GENERATED\nvar user User\n"
+	if got := replaceString(t, "a.go", text, "-only-region", "user", "member"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// The default markers are not used with the specified ones
+	if got := replaceString(t, "a.txt", "# BEGIN\nuser\n# END\n"+text, "-only-region", "-region-start", "# BEGIN", "-region-end", "# END", "user", "member"); got != "# BEGIN\nmember\n# END\n"+text {
+		t.Errorf("got %q", got)
+	}
+
+	for _, args := range [][]string{{"-region-start", "BEGIN"}, {"-region-end", "END"}} {
+		if _, err := tryParseOptions(t, append(args, "user", "member")...); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
+
+func TestNoRecurse(t *testing.T) {
+	files := map[string]string{"user.txt": "user\n", "user/user.txt": "user\n", "a/b/user.txt": "user\n"}
+	for _, args := range [][]string{{"-no-recurse"}, {"-no-recurse", "-max-depth", "2"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			want := map[string]string{"member.txt": "member\n", "user/user.txt": "user\n", "a/b/user.txt": "user\n"}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestElideLongLines(t *testing.T) {
+	ctx := func(c string) string { return strings.Repeat(c, elisionContext) }
+	// A minified file of a single line of 10,000 characters
+	before := strings.Repeat("a", 5000) + "user" + strings.Repeat("b", 4996)
+	after := strings.Repeat("a", 5000) + "group" + strings.Repeat("b", 4996)
+	diff := elideLongLines(unifiedDiff("app.min.js", before, after, diffAlgorithms["myers"]))
+	want := "--- a/app.min.js\n+++ b/app.min.js\n@@ -1 +1 @@\n" +
+		"-..." + ctx("a") + "user" + ctx("b") + "...\n" +
+		"\\ No newline at end of file\n" +
+		"+..." + ctx("a") + "group" + ctx("b") + "...\n" +
+		"\\ No newline at end of file\n"
+	if diff != want {
+		t.Errorf("got %q, want %q", diff, want)
+	}
+
+	// A change near the beginning is shown from the beginning
+	diff = elideLongLines(unifiedDiff("a.js", "user"+before+"\n", "group"+before+"\n", diffAlgorithms["myers"]))
+	if want := "-user" + ctx("a") + "...\n+group" + ctx("a") + "...\n"; !strings.HasSuffix(diff, want) {
+		t.Errorf("got %q, want the suffix %q", diff, want)
+	}
+
+	// Long lines which aren't paired are cut down to their beginning
+	long := strings.Repeat("x", 1000)
+	diff = elideLongLines(unifiedDiff("a.txt", "user\n", "member\n"+long+"\n", diffAlgorithms["myers"]))
+	if want := "-user\n+member\n+" + strings.Repeat("x", 2*elisionContext) + "... (920 more characters)\n"; !strings.HasSuffix(diff, want) {
+		t.Errorf("got %q, want the suffix %q", diff, want)
+	}
+
+	// Short lines and the headers are kept as they are
+	diff = unifiedDiff(long+".txt", "user\n", "member\n", diffAlgorithms["myers"])
+	if got := elideLongLines(diff); got != diff {
+		t.Errorf("got %q, want %q", got, diff)
+	}
+}
+
+func TestReportFile(t *testing.T) {
+	files := map[string]string{"user/user.txt": "user user\n", "a.txt": "User\n", "b.txt": "nothing\n"}
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "run",
+			input: "y\n",
+			want: "replace-word user => member\n" +
+				"\nChanged files: 2 (3 replacements)\n  a.txt (1 replacements)\n  user/user.txt (2 replacements)\n" +
+				"\nRenames: 2\n  user/user.txt => user/member.txt\n  user => member\n",
+		},
+		{
+			name: "JSON",
+			args: []string{"-dry-run", "-format", "json"},
+			want: "replace-word user => member\n(dry run)\n" +
+				"\nChanged files: 2 (3 replacements)\n  a.txt (1 replacements)\n  user/user.txt (2 replacements)\n" +
+				"\nRenames: 2\n  user/user.txt => user/member.txt\n  user => member\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			report := filepath.Join(t.TempDir(), "report.txt")
+			result := runCLI(t, dir, tt.input, append(append([]string{"-report-file", report}, tt.args...), "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			bs, err := os.ReadFile(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(bs) != tt.want {
+				t.Errorf("got %q, want %q", bs, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeletion(t *testing.T) {
+	// The before words are just removed in all forms, leaving the separators around them
+	text := "old-user-name oldUserName OldUserName OLD_USER_NAME old user\n"
+	want := "-name Name Name _NAME \n"
+	if got := replaceString(t, "a.txt", text, "old-user", ""); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	for _, it := range generateDictForText("old-user", "").items {
+		if it.before == "" || it.after != "" {
+			t.Errorf("%s: got %q => %q", it.form, it.before, it.after)
+		}
+	}
+
+	// A name can't be deleted entirely
+	discardOutput(t)
+	dir := writeTree(t, map[string]string{"old-user/old-user-name.txt": ""})
+	opts := parseOptions(t, "-dir", dir, "old-user", "")
+	if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName("old-user", ""), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"old-user/-name.txt": ""}; !reflect.DeepEqual(readTree(t, dir), want) {
+		t.Errorf("got %v, want %v", readTree(t, dir), want)
+	}
+
+	// An empty before word is rejected even if it's expanded from an environment variable
+	t.Setenv("EMPTY", "")
+	for _, args := range [][]string{{"", "member"}, {"", ""}, {"-expand-env", "$EMPTY", "member"}, {"-expand-env", "-literal", "$EMPTY", "member"}} {
+		if _, err := tryParseOptions(t, args...); err == nil || err.Error() != "before words must not be empty" {
+			t.Errorf("%q: got %v", args, err)
+		}
+	}
+	if opts := parseOptions(t, "-expand-env", "old-user", "$EMPTY"); opts.after != "" {
+		t.Errorf("got %q", opts.after)
+	}
+	// So is a before word which is empty in a form, which would insert the after word between every character
+	for _, args := range [][]string{{"-", "member"}, {"-", ""}, {"-two-pass", "-", "member"}} {
+		if _, err := tryParseOptions(t, args...); err == nil || !strings.HasPrefix(err.Error(), "before words must not be empty in the ") {
+			t.Errorf("%q: got %v", args, err)
+		}
+	}
+	if _, err := tryParseOptions(t, "-literal", "-", "member"); err != nil {
+		t.Errorf("-literal: got %v", err)
+	}
+
+	// A file name can't be left only with its extension
+	if _, err := tryParseOptions(t, "-exact-filename", "old-user", ""); err == nil || err.Error() != "-exact-filename can't be used with an empty after word" {
+		t.Errorf("-exact-filename: got %v", err)
+	}
+}
+
+func TestAllowPartialWord(t *testing.T) {
+	text := "user users superuser, user.\n"
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-prose"}, want: "member users superuser, member.\n"},
+		// The flag only overrides -prose, so it's the same as the default substring matching
+		{args: []string{"-prose", "-allow-partial-word"}, want: "member members supermember, member.\n"},
+		{args: []string{"-allow-partial-word"}, want: "member members supermember, member.\n"},
+		{args: nil, want: "member members supermember, member.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if got := replaceString(t, "a.md", text, append(tt.args, "user", "member")...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The options incompatible with -prose are allowed once it's overridden
+	if _, err := tryParseOptions(t, "-prose", "-two-pass", "user", "member"); err == nil {
+		t.Error("-two-pass with -prose is accepted")
+	}
+	if opts, err := tryParseOptions(t, "-prose", "-allow-partial-word", "-two-pass", "user", "member"); err != nil || opts.prose {
+		t.Errorf("got %v with prose %v", err, opts.prose)
+	}
+
+	// The files are changed differently by the CLI as well
+	dir := writeTree(t, map[string]string{"a.md": text})
+	if result := runCLI(t, dir, "y\n", "-prose", "user", "member"); result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if got, want := readTree(t, dir)["a.md"], "member users superuser, member.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	dir = writeTree(t, map[string]string{"a.md": text})
+	if result := runCLI(t, dir, "y\n", "-prose", "-allow-partial-word", "user", "member"); result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if got, want := readTree(t, dir)["a.md"], "member members supermember, member.\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+// writeZip writes a zip archive of the entries ordered by name, where a name ending with a slash is a dir.
+func writeZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(entries[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readZip returns the entries of the zip archive.
+func readZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	entries := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[f.Name] = string(bs)
+	}
+	return entries
+}
+
+// writeTar writes a tar archive of the regular files ordered by name.
+func writeTar(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := tar.NewWriter(f)
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(entries[name])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entries[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTar returns the entries of the tar archive.
+func readTar(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := tar.NewReader(f)
+	entries := map[string]string{}
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bs, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[header.Name] = string(bs)
+	}
+	return entries
+}
+
+// withoutDirs returns the entries except the dirs whose names end with a slash.
+func withoutDirs(entries map[string]string) map[string]string {
+	files := map[string]string{}
+	for name, content := range entries {
+		if !strings.HasSuffix(name, "/") {
+			files[name] = content
+		}
+	}
+	return files
+}
+
+func TestArchive(t *testing.T) {
+	entries := map[string]string{
+		"user/":          "",
+		"user/user.txt":  "Hello, user\n",
+		"user/a.md":      "# User\n",
+		"bin/user.bin":   "user\x00\n",
+		"docs/empty.txt": "",
+	}
+	want := map[string]string{
+		"member/":           "",
+		"member/member.txt": "Hello, member\n",
+		"member/a.md":       "# Member\n",
+		"bin/member.bin":    "user\x00\n",
+		"docs/empty.txt":    "",
+	}
+	for _, ext := range []string{".zip", ".tar"} {
+		t.Run(ext, func(t *testing.T) {
+			write, read := writeZip, readZip
+			entries, want := entries, want
+			if ext == ".tar" {
+				// Only regular files are written to the tar archive
+				write, read = writeTar, readTar
+				entries, want = withoutDirs(entries), withoutDirs(want)
+			}
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "a"+ext)
+			write(t, archive, entries)
+
+			// A dry run shows the diffs and the renames without writing the archive
+			result := runCLI(t, dir, "", "-archive", archive, "-dry-run", "user", "member")
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			for _, s := range []string{"+++ b/" + archive + ":user/user.txt\n", archive + ":user/user.txt => member/member.txt\n"} {
+				if !strings.Contains(result.stdout, s) {
+					t.Errorf("no %q: %s", s, result.stdout)
+				}
+			}
+			if got := read(t, archive); !reflect.DeepEqual(got, entries) {
+				t.Errorf("changed in a dry run: %v", got)
+			}
+
+			out := filepath.Join(dir, "b"+ext)
+			result = runCLI(t, dir, "y\n", "-archive", archive, "-archive-out", out, "user", "member")
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := read(t, out); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got := read(t, archive); !reflect.DeepEqual(got, entries) {
+				t.Errorf("changed with -archive-out: %v", got)
+			}
+
+			// The archive is overwritten without -archive-out
+			result = runCLI(t, dir, "y\n", "-archive", archive, "user", "member")
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := read(t, archive); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := tryParseOptions(t, "-archive", "a.tar.gz", "user", "member"); err == nil || err.Error() != "unsupported archive: a.tar.gz" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestJSONLFormat(t *testing.T) {
+	dir := writeTree(t, map[string]string{"user/user.txt": "user\n", "a.txt": "user\n", "b.txt": "nothing\n"})
+	result := runCLI(t, dir, "", "-dry-run", "-format", "jsonl", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	// A line is printed as soon as each file is replaced or renamed
+	want := []fileReport{
+		{Path: "a.txt", Diff: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-user\n+member\n"},
+		{Path: "user/user.txt", Diff: "--- a/user/user.txt\n+++ b/user/user.txt\n@@ -1 +1 @@\n-user\n+member\n"},
+		{Path: "user/user.txt", Rename: &renameResult{From: "user/user.txt", To: "user/member.txt"}},
+		{Path: "user", Rename: &renameResult{From: "user", To: "member"}},
+	}
+	lines := strings.Split(strings.TrimSuffix(result.stdout, "\n"), "\n")
+	var got []fileReport
+	for _, line := range lines {
+		var report fileReport
+		if err := json.Unmarshal([]byte(line), &report); err != nil {
+			t.Fatalf("%v: %q", err, line)
+		}
+		got = append(got, report)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %+v", lines, want)
+	}
+
+	if _, err := tryParseOptions(t, "-format", "jsonl", "user", "member"); err == nil {
+		t.Error("-format=jsonl is accepted without -dry-run")
+	}
+}
+
+func TestFormOrder(t *testing.T) {
+	// "User" is the before word of the three forms, whose after words differ
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: nil, want: "MemberAccount memberAccount\n"},
+		{args: []string{"-form-order", "capitalized-space"}, want: "Member account memberAccount\n"},
+		{args: []string{"-form-order", "upper-space,upper-camel"}, want: "Member Account memberAccount\n"},
+		{args: []string{"-form-order", "lower-space", "-form-order", "capitalized-space"}, want: "Member account member account\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if got := replaceString(t, "a.txt", "User user\n", append(tt.args, "user", "member-account")...); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The unlisted forms follow in the default order
+	var forms []string
+	for _, it := range generateDictForText("user", "member").ordered([]string{"flat", "snake"}).items {
+		forms = append(forms, it.form)
+	}
+	want := []string{"flat", "snake", "upper-camel", "lower-camel", "screaming-snake", "screaming-kebab", "kebab", "upper-flat", "upper-space", "capitalized-space", "lower-space"}
+	if !reflect.DeepEqual(forms, want) {
+		t.Errorf("got %v, want %v", forms, want)
+	}
+
+	if _, err := tryParseOptions(t, "-form-order", "camel", "user", "member"); err == nil {
+		t.Error("unknown form is accepted")
+	}
+}
+
+func TestHelpForms(t *testing.T) {
+	result := runCLI(t, t.TempDir(), "", "-help-forms")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := `upper-camel:        UserProfile
+lower-camel:        userProfile
+screaming-snake:    USER_PROFILE
+snake:              user_profile
+screaming-kebab:    USER-PROFILE
+kebab:              user-profile
+upper-flat:         USERPROFILE
+flat:               userprofile
+upper-space:        User Profile
+capitalized-space:  User profile
+lower-space:        user profile
+`
+	if result.stdout != want {
+		t.Errorf("got\n%s\nwant\n%s", result.stdout, want)
+	}
+	// Every form is listed
+	if n := strings.Count(result.stdout, "\n"); n != len(caseForms) {
+		t.Errorf("got %d forms, want %d", n, len(caseForms))
+	}
+}
+
+func TestRegex(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		text          string
+		want          string
+	}{
+		{name: "capture group", before: `user_(\w+)`, after: "member_${1}_v2", text: "user_id user_name\n", want: "member_id_v2 member_name_v2\n"},
+		{name: "named group", before: `(?P<kind>get|set)User`, after: "${kind}Member", text: "getUser setUser\n", want: "getMember setMember\n"},
+		// No case forms are generated from the pattern
+		{name: "no case forms", before: "user", after: "member", text: "user User USER\n", want: "member User USER\n"},
+		{name: "delete", before: `\s*// TODO: user\n`, after: "", text: "a // TODO: user\nb\n", want: "ab\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, "a.txt", tt.text, "-regex", tt.before, tt.after); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// File names are renamed with the pattern as well
+	dir := writeTree(t, map[string]string{"user_1.txt": "user_1\n", "user_a.txt": "user_a\n"})
+	result := runCLI(t, dir, "y\n", "-regex", `user_(\d)`, "member-$1")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := map[string]string{"member-1.txt": "member-1\n", "user_a.txt": "user_a\n"}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := tryParseOptions(t, "-regex", "user(", "member"); err == nil || !strings.HasPrefix(err.Error(), "invalid -regex pattern: ") {
+		t.Errorf("got %v", err)
+	}
+	if _, err := tryParseOptions(t, "-regex", "-expand-env", "$USER", "member"); err == nil || err.Error() != "-expand-env can't be used with -regex" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDumpTargets(t *testing.T) {
+	files := map[string]string{"b/user.go": "user\n", "a.txt": "user\n", "c.md": "user\n", "user.bin": "user\x00\n", "node_modules/x.js": "user\n"}
+	dir := writeTree(t, files)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-dump-targets"}, want: "a.txt\nb/user.go\nc.md\n"},
+		{args: []string{"-dump-targets", "-include", "*.go,*.md"}, want: "b/user.go\nc.md\n"},
+		{args: []string{"-dump-targets", "-exclude", "b", "user", "member"}, want: "a.txt\nc.md\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			result := runCLI(t, dir, "", tt.args...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if result.stdout != tt.want {
+				t.Errorf("got %q, want %q", result.stdout, tt.want)
+			}
+		})
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("changed: %v", got)
+	}
+}
+
+func TestBOM(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		text string
+		want string
+	}{
+		{name: "kept", text: utf8BOM + "user\n", want: utf8BOM + "member\n"},
+		{name: "stripped", args: []string{"-strip-bom"}, text: utf8BOM + "user\n", want: "member\n"},
+		{name: "stripped without match", args: []string{"-strip-bom"}, text: utf8BOM + "nothing\n", want: "nothing\n"},
+		{name: "no BOM", args: []string{"-strip-bom"}, text: "user\n", want: "member\n"},
+		// The front matter is found after the BOM
+		{name: "front matter", args: []string{"-skip-frontmatter"}, text: utf8BOM + "---\nuser: user\n---\nuser\n", want: utf8BOM + "---\nuser: user\n---\nmember\n"},
+		// A BOM in the middle is not touched
+		{name: "not leading", args: []string{"-strip-bom"}, text: "user" + utf8BOM + "\n", want: "member" + utf8BOM + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, map[string]string{"a.md": tt.text})
+			result := runCLI(t, dir, "y\n", append(tt.args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir)["a.md"]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenameWithTextDict(t *testing.T) {
+	files := map[string]string{"User Profile.txt": "", "user profile/a.md": "", "UserProfile.go": ""}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "text dict",
+			args: []string{"-rename-with-text-dict", "-rename-only"},
+			want: map[string]string{"Member Account.txt": "", "member account/a.md": "", "MemberAccount.go": ""},
+		},
+		{
+			name: "file name dict",
+			args: []string{"-rename-only"},
+			want: map[string]string{"User Profile.txt": "", "user profile/a.md": "", "MemberAccount.go": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(tt.args, "user-profile", "member-account")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImpactSummary(t *testing.T) {
+	// The binary file is neither replaced nor renamed
+	files := map[string]string{"user/user.txt": "user user\n", "a.txt": "User\n", "b.txt": "nothing\n", "user.bin": "user\x00"}
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{want: "2 files, 3 replacements, 2 renames will be applied\nDo you replace words, sure? [y/N]: Cancelled.\n"},
+		{args: []string{"-rename-only"}, want: "0 files, 0 replacements, 2 renames will be applied\nDo you replace words, sure? [y/N]: Cancelled.\n"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "n\n", append(tt.args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if !strings.HasSuffix(result.stdout, tt.want) {
+				t.Errorf("got %q, want the suffix %q", result.stdout, tt.want)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+				t.Errorf("changed: %v", got)
+			}
+		})
+	}
+}
+
+func TestStrictUTF8(t *testing.T) {
+	files := map[string]string{"a.txt": "user\n", "b.txt": "user \xff\n"}
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want map[string]string
+	}{
+		{name: "default", want: map[string]string{"a.txt": "member\n", "b.txt": "member \xff\n"}},
+		{name: "skipped", args: []string{"-strict-utf8"}, want: map[string]string{"a.txt": "member\n", "b.txt": "user \xff\n"}},
+		{name: "failed", args: []string{"-strict-utf8", "-strict"}, code: 1, want: files},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(tt.args, "user", "member")...)
+			if result.code != tt.code {
+				t.Fatalf("exit code %d, want %d: %s", result.code, tt.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if tt.args != nil && !strings.Contains(result.stderr, "b.txt") {
+				t.Errorf("b.txt not reported: %q", result.stderr)
+			}
+		})
+	}
+}
+
+func TestFormsFile(t *testing.T) {
+	const text = "UserProfile userProfile user-profile user_profile\n"
+	dir := writeTree(t, map[string]string{
+		"a.txt":                             text,
+		"backend/.replaceword.forms":        "# Go\nupper-camel, lower-camel\n",
+		"backend/a.go":                      text,
+		"backend/legacy/.replaceword.forms": "snake\n",
+		"backend/legacy/a.go":               text,
+		"frontend/.replaceword.forms":       "kebab\n",
+		"frontend/a.ts":                     text,
+	})
+	result := runCLI(t, dir, "y\n", "user-profile", "member-account")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := map[string]string{
+		"a.txt":                             "MemberAccount memberAccount member-account member_account\n",
+		"backend/.replaceword.forms":        "# Go\nupper-camel, lower-camel\n",
+		"backend/a.go":                      "MemberAccount memberAccount user-profile user_profile\n",
+		"backend/legacy/.replaceword.forms": "snake\n",
+		// The nearest forms file takes precedence
+		"backend/legacy/a.go":         "UserProfile userProfile user-profile member_account\n",
+		"frontend/.replaceword.forms": "kebab\n",
+		"frontend/a.ts":               "UserProfile userProfile member-account user_profile\n",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	dir = writeTree(t, map[string]string{"a/.replaceword.forms": "upper-camel, camel\n", "a/a.go": text})
+	result = runCLI(t, dir, "y\n", "user-profile", "member-account")
+	if result.code != 1 || !strings.Contains(result.stderr, "unknown form: camel") {
+		t.Errorf("exit code %d: %q", result.code, result.stderr)
+	}
+}
+
+func TestContextPattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		text    string
+		want    string
+	}{
+		{name: "type", pattern: `type \w+`, text: "type user struct{}\nvar u user // user\n", want: "type member struct{}\nvar u user // user\n"},
+		{name: "all forms in a match", pattern: `type \w+`, text: "type User struct{}\ntype userList []User\n", want: "type Member struct{}\ntype memberList []User\n"},
+		{name: "no match", pattern: `type \w+`, text: "var user User\n", want: "var user User\n"},
+		{name: "multiple lines", pattern: `(?s)BEGIN.*?END`, text: "user\nBEGIN\nuser\nEND\nuser\n", want: "user\nBEGIN\nmember\nEND\nuser\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, "a.go", tt.text, "-context-pattern", tt.pattern, "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := tryParseOptions(t, "-context-pattern", "type (", "user", "member"); err == nil {
+		t.Error("invalid pattern is accepted")
+	}
+}
+
+func TestPatchFormat(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+	var lines []string
+	for i := 1; i <= 20; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines[2], lines[17] = "user", "User"
+	// No renames are included in a patch, so no names contain the words
+	files := map[string]string{
+		"a.txt":       "user\nUser\n",
+		"b/c/d.go":    "package c\n\ntype User struct{}\n",
+		"b/long.txt":  strings.Join(lines, "\n") + "\n",
+		"no-eol.txt":  "USER",
+		"nothing.txt": "nothing\n",
+	}
+
+	// A truncated diff is only shown, and the patch is complete
+	result := runCLI(t, writeTree(t, files), "", "-dry-run", "-format", "patch", "-max-diff-lines", "1", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if strings.Contains(result.stdout, "\x1b[") {
+		t.Errorf("colored: %q", result.stdout)
+	}
+	patched := writeTree(t, files)
+	gitApply(t, patched, result.stdout)
+
+	replaced := writeTree(t, files)
+	if result := runCLI(t, replaced, "y\n", "user", "member"); result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	if got, want := readTree(t, patched), readTree(t, replaced); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := readTree(t, replaced); reflect.DeepEqual(got, files) {
+		t.Error("nothing is replaced")
+	}
+	if _, err := tryParseOptions(t, "-format", "patch", "user", "member"); err == nil {
+		t.Error("-format patch without -dry-run is accepted")
+	}
+
+	// The same file in the dirs matched by a glob is told by the paths relative to their common dir
+	files = map[string]string{"services/a/src/user.txt": "user\n", "services/b/src/user.txt": "user\n"}
+	result = runCLI(t, writeTree(t, files), "", "-dry-run", "-format", "patch", "-dir", "services/*/src", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	for _, header := range []string{"--- a/a/src/user.txt\n", "+++ b/b/src/user.txt\n"} {
+		if !strings.Contains(result.stdout, header) {
+			t.Errorf("no %q in %q", header, result.stdout)
+		}
+	}
+	patched = writeTree(t, files)
+	gitApply(t, filepath.Join(patched, "services"), result.stdout)
+	want := map[string]string{"services/a/src/user.txt": "member\n", "services/b/src/user.txt": "member\n"}
+	if got := readTree(t, patched); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCollectErrors(t *testing.T) {
+	discardOutput(t)
+	setup := func(t *testing.T, args ...string) (string, options, []targetFile) {
+		dir := writeTree(t, map[string]string{"b-deleted.txt": "user\n", "c-read-only.txt": "user\n", "d-broken.gz": "user\n", "z.txt": "user\n"})
+		opts := parseOptions(t, append([]string{"-dir", dir, "-gzip", "-force-text", "*.gz"}, append(args, "user", "member")...)...)
+		files := textFiles(findTargets(t, dir, opts))
+		// The files are broken after they are found
+		if err := os.Remove(filepath.Join(dir, "b-deleted.txt")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(filepath.Join(dir, "c-read-only.txt"), 0400); err != nil {
+			t.Fatal(err)
+		}
+		return dir, opts, files
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		dir, opts, files := setup(t)
+		if _, _, err := replaceText(files, generateDictForText(opts.before, opts.after), opts); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got %v", err)
+		}
+		if got := readTree(t, dir)["z.txt"]; got != "user\n" {
+			t.Errorf("processed after the error: %q", got)
+		}
+	})
+
+	t.Run("collected", func(t *testing.T) {
+		dir, opts, files := setup(t, "-collect-errors")
+		changed, _, err := replaceText(files, generateDictForText(opts.before, opts.after), opts)
+		if err == nil {
+			t.Fatal("no error")
+		}
+		want := []string{"  encoding: 1", "  I/O: 1"}
+		wantChanged := []string{"c-read-only.txt", "z.txt"}
+		if os.Geteuid() != 0 {
+			// Root can write any file regardless of the permission
+			want = append([]string{"  permission: 1"}, want...)
+			wantChanged = []string{"z.txt"}
+		}
+		var got []string
+		for _, line := range strings.Split(err.Error(), "\n") {
+			if strings.HasPrefix(line, "  ") && !strings.HasPrefix(line, "    ") {
+				got = append(got, line)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if !strings.HasPrefix(err.Error(), fmt.Sprintf("%d files failed\n", len(want))) {
+			t.Errorf("got %q", err)
+		}
+		for _, name := range []string{"b-deleted.txt", "d-broken.gz"} {
+			if !strings.Contains(err.Error(), filepath.Join(dir, name)) {
+				t.Errorf("%s is not listed: %q", name, err)
+			}
+		}
+		if got := readTree(t, dir)["z.txt"]; got != "member\n" {
+			t.Errorf("not processed after the errors: %q", got)
+		}
+		var gotChanged []string
+		for _, result := range changed {
+			gotChanged = append(gotChanged, filepath.Base(result.path))
+		}
+		if !reflect.DeepEqual(gotChanged, wantChanged) {
+			t.Errorf("got changed %v, want %v", gotChanged, wantChanged)
+		}
+	})
+}
+
+func TestRenamePermissionError(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can rename in a read-only dir")
+	}
+	// The renames run from leaf to root in the reverse order of the paths, so the read-only dir comes first
+	files := map[string]string{"a/user.txt": "", "user.md": "", "z-locked/user.txt": ""}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "abort", want: files},
+		{
+			name: "keep going",
+			args: []string{"-keep-going"},
+			want: map[string]string{"a/member.txt": "", "member.md": "", "z-locked/user.txt": ""},
+		},
+		{
+			name: "keep going concurrently",
+			args: []string{"-keep-going", "-jobs", "4"},
+			want: map[string]string{"a/member.txt": "", "member.md": "", "z-locked/user.txt": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			locked := filepath.Join(dir, "z-locked")
+			if err := os.Chmod(locked, 0555); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = os.Chmod(locked, 0755)
+			})
+			result := runCLI(t, dir, "y\n", append(tt.args, "-rename-only", "user", "member")...)
+			if result.code != 1 {
+				t.Errorf("exit code %d: %s", result.code, result.stderr)
+			}
+			want := filepath.FromSlash("failed to rename z-locked/user.txt => z-locked/member.txt: permission denied")
+			if !strings.Contains(result.stderr, want) {
+				t.Errorf("got %q, want %q", result.stderr, want)
+			}
+			if tt.args != nil && !strings.Contains(result.stderr, "1 renames failed\n  permission: 1\n") {
+				t.Errorf("no summary: %q", result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireAllForms(t *testing.T) {
+	files := map[string]string{"all.go": "User user USER\n", "some.go": "User user\n", "nothing.go": "nothing\n"}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "default",
+			want: map[string]string{"all.go": "Member member MEMBER\n", "some.go": "Member member\n", "nothing.go": "nothing\n"},
+		},
+		{
+			name: "required",
+			args: []string{"-require-all-forms"},
+			want: map[string]string{"all.go": "Member member MEMBER\n", "some.go": "User user\n", "nothing.go": "nothing\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(tt.args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			warning := `some.go: skipped because only some forms of the words are present (missing: "USER")`
+			if got := strings.Contains(result.stderr, warning); got != (tt.args != nil) {
+				t.Errorf("got %q", result.stderr)
+			}
+			if strings.Contains(result.stderr, "all.go") || strings.Contains(result.stderr, "nothing.go") {
+				t.Errorf("warned about a consistent file: %q", result.stderr)
+			}
+		})
+	}
+
+	// The file never uses kebab-case, flatcase or spaces, which are not required
+	t.Run("multiple words", func(t *testing.T) {
+		dir := writeTree(t, map[string]string{
+			"user.go": "type UserProfile struct{}\nvar userProfile UserProfile\nconst USER_PROFILE = \"user_profile\"\n",
+			"some.go": "var userProfile UserProfile\nconst USER_PROFILE = 1\n",
+		})
+		result := runCLI(t, dir, "y\n", "-require-all-forms", "user-profile", "member-profile")
+		if result.code != 0 {
+			t.Fatalf("exit code %d: %s", result.code, result.stderr)
+		}
+		want := map[string]string{
+			"user.go": "type MemberProfile struct{}\nvar memberProfile MemberProfile\nconst MEMBER_PROFILE = \"member_profile\"\n",
+			"some.go": "var userProfile UserProfile\nconst USER_PROFILE = 1\n",
+		}
+		if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if got, want := result.stderr, `some.go: skipped because only some forms of the words are present (missing: "user_profile")`; !strings.Contains(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestModifiedSince(t *testing.T) {
+	dir := writeTree(t, map[string]string{"new.txt": "user\n", "old.txt": "user\n", "sub/old.txt": "user\n", "sub/recent.txt": "user\n"})
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"old.txt": 48 * time.Hour, "sub/old.txt": 25 * time.Hour, "sub/recent.txt": time.Hour} {
+		mtime := now.Add(-age)
+		if err := os.Chtimes(filepath.Join(dir, filepath.FromSlash(name)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		since string
+		want  []string
+	}{
+		{since: "0", want: []string{"new.txt", "old.txt", "sub/old.txt", "sub/recent.txt"}},
+		{since: "24h", want: []string{"new.txt", "sub/recent.txt"}},
+		{since: "30m", want: []string{"new.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since, func(t *testing.T) {
+			opts := parseOptions(t, "-dir", dir, "-modified-since", tt.since, "user", "member")
+			if got := relativePaths(t, dir, textFiles(findTargets(t, dir, opts))); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := tryParseOptions(t, "-modified-since", "-1h", "user", "member"); err == nil {
+		t.Error("negative duration is accepted")
+	}
+}
+
+func TestDictFile(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		// No case forms are generated, so PERSON is left as is
+		"person.txt":     "person Person PERSON\n",
+		"Person/a.go":    "var person Person\n",
+		"persons.md":     "persons\n",
+		"words/dict.tsv": "# Irregular plurals\r\nperson\tpeople\r\n\r\nPerson\tPeople\r\n",
+	})
+	result := runCLI(t, dir, "y\n", "-dict-file", "words/dict.tsv", "-exclude", "words")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := map[string]string{
+		"people.txt":     "people People PERSON\n",
+		"People/a.go":    "var people People\n",
+		"peoples.md":     "peoples\n",
+		"words/dict.tsv": "# Irregular plurals\r\nperson\tpeople\r\n\r\nPerson\tPeople\r\n",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	errorTests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "no tab", content: "person\tpeople\nperson people\n", want: `:2: expected "before<TAB>after"`},
+		{name: "empty before", content: "\tpeople\n", want: `:1: expected "before<TAB>after"`},
+		{name: "no words", content: "# nothing\n\n", want: ": no words"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dict.tsv")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readDictFile(path); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{{"-dict-file", "dict.tsv", "user", "member"}, {"-dict-file", "dict.tsv", "-literal"}} {
+		if _, err := tryParseOptions(t, args...); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
+
+func TestRenameMap(t *testing.T) {
+	files := map[string]string{"user/user.txt": "", "user/a.txt": "", "user.md": ""}
+	// The paths under a renamed dir are mapped to their final paths
+	want := map[string]string{
+		"user":          "member",
+		"user/user.txt": "member/member.txt",
+		"user.md":       "member.md",
+	}
+	for _, args := range [][]string{nil, {"-dry-run"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			dir := writeTree(t, files)
+			path := filepath.Join(t.TempDir(), "map.json")
+			result := runCLI(t, dir, "y\n", append(args, "-rename-only", "-rename-map", path, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			bs, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(bs, &got); err != nil {
+				t.Fatal(err)
+			}
+			wantMap := map[string]string{}
+			for from, to := range want {
+				wantMap[filepath.FromSlash(from)] = filepath.FromSlash(to)
+			}
+			if !reflect.DeepEqual(got, wantMap) {
+				t.Errorf("got %v, want %v", got, wantMap)
+			}
+			wantTree := map[string]string{"member/member.txt": "", "member/a.txt": "", "member.md": ""}
+			if args != nil {
+				wantTree = files
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, wantTree) {
+				t.Errorf("got %v, want %v", got, wantTree)
+			}
+		})
+	}
+}
+
+func TestLiteral(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		files         map[string]string
+		want          map[string]string
+	}{
+		{
+			// No other case forms are replaced
+			name:   "no case forms",
+			before: "user-id", after: "member_ID",
+			files: map[string]string{"user-id.txt": "user-id User-Id user_id userId USER-ID\n", "userId.go": "userId\n"},
+			want:  map[string]string{"member_ID.txt": "member_ID User-Id user_id userId USER-ID\n", "userId.go": "userId\n"},
+		},
+		{
+			// The arguments don't have to be hyphenated words, and no meta characters are interpreted
+			name:   "not words",
+			before: "v1.2", after: "v1.3 (beta)",
+			files: map[string]string{"a.md": "v1.2 v1x2 V1.2\n"},
+			want:  map[string]string{"a.md": "v1.3 (beta) v1x2 V1.2\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, tt.files)
+			result := runCLI(t, dir, "y\n", "-literal", tt.before, tt.after)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	for _, args := range [][]string{{"-literal", "-regex"}, {"-literal", "-smart-case"}} {
+		if _, err := tryParseOptions(t, append(args, "user", "member")...); err == nil {
+			t.Errorf("%v is accepted", args)
+		}
+	}
+}
+
+func TestDiffColors(t *testing.T) {
+	enableColor(t)
+	discardOutput(t)
+	var buf bytes.Buffer
+	messages = &buf
+	opts := parseOptions(t, "-color-add", "blue", "-color-remove", "hi-yellow", "-dry-run", "user", "member")
+	addColor, removeColor = colorNames[opts.colorAdd], colorNames[opts.colorRemove]
+
+	diff := unifiedDiff("a.txt", "user\n", "member\n", diffAlgorithms["myers"])
+	want := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n\x1b[93m-user\x1b[0m\n\x1b[34m+member\x1b[0m\n"
+	if got := colorizeDiff(diff); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	dir := writeTree(t, map[string]string{"user.txt": ""})
+	if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	want = filepath.Join(dir, "\x1b[93muser.txt\x1b[0m") + " => " + filepath.Join(dir, "\x1b[34mmember.txt\x1b[0m") + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The defaults are the same as before
+	opts = parseOptions(t, "user", "member")
+	if colorNames[opts.colorAdd] != color.FgGreen || colorNames[opts.colorRemove] != color.FgRed {
+		t.Errorf("got %s and %s", opts.colorAdd, opts.colorRemove)
+	}
+	if _, err := tryParseOptions(t, "-color-add", "pink", "user", "member"); err == nil {
+		t.Error("unknown color is accepted")
+	}
+}
+
+func TestConfirmRenames(t *testing.T) {
+	discardOutput(t)
+	// The renames are confirmed from leaf to root in the order of c, b and a
+	files := map[string]string{"a/user.txt": "", "b/user.txt": "", "c/user.txt": ""}
+	tests := []struct {
+		name    string
+		input   string
+		prompts int
+		want    map[string]string
+	}{
+		{name: "yes", input: "y\nyes\nY\n", prompts: 3, want: map[string]string{"a/member.txt": "", "b/member.txt": "", "c/member.txt": ""}},
+		{name: "no", input: "n\ny\nno\n", prompts: 3, want: map[string]string{"a/user.txt": "", "b/member.txt": "", "c/user.txt": ""}},
+		{name: "all", input: "n\na\n", prompts: 2, want: map[string]string{"a/member.txt": "", "b/member.txt": "", "c/user.txt": ""}},
+		{name: "quit", input: "y\nq\ny\n", prompts: 2, want: map[string]string{"a/user.txt": "", "b/user.txt": "", "c/member.txt": ""}},
+		// An unknown answer is asked again
+		{name: "unknown", input: "x\ny\n\nn\ny\n", prompts: 5, want: map[string]string{"a/member.txt": "", "b/user.txt": "", "c/member.txt": ""}},
+		// Nothing is renamed after the end of the input
+		{name: "end of input", input: "y\n", prompts: 2, want: map[string]string{"a/user.txt": "", "b/user.txt": "", "c/member.txt": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			opts := parseOptions(t, "-dir", dir, "-confirm-renames", "user", "member")
+			var out bytes.Buffer
+			confirmer := &renameConfirmer{in: strings.NewReader(tt.input), out: &out}
+			if _, err := renameFilesAndDirs(dir, findTargets(t, dir, opts), generateDictForFileName(opts.before, opts.after), confirmer, opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := strings.Count(out.String(), "[y/n/a/q]: "); got != tt.prompts {
+				t.Errorf("got %d prompts, want %d: %q", got, tt.prompts, out.String())
+			}
+		})
+	}
+
+	// The answers follow the answer of the confirmation before replacing in stdin
+	dir := writeTree(t, files)
+	result := runCLI(t, dir, "y\nn\ny\nn\n", "-confirm-renames", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := map[string]string{"a/user.txt": "", "b/member.txt": "", "c/user.txt": ""}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if !strings.Contains(result.stdout, "Rename "+filepath.Join("c", "user.txt")+" => "+filepath.Join("c", "member.txt")+"? [y/n/a/q]: ") {
+		t.Errorf("no prompt: %q", result.stdout)
+	}
+}
+
+func TestRenameBinary(t *testing.T) {
+	// A PNG header is sniffed as binary
+	const png = "\x89PNG\r\n\x1a\n\x00\x00user"
+	files := map[string]string{"user-avatar.png": png, "user.txt": "user\n"}
+	tests := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{name: "default", want: map[string]string{"user-avatar.png": png, "member.txt": "member\n"}},
+		// The content of the binary file is kept as is
+		{name: "renamed", args: []string{"-rename-binary"}, want: map[string]string{"member-avatar.png": png, "member.txt": "member\n"}},
+		{name: "rename only", args: []string{"-rename-binary", "-rename-only"}, want: map[string]string{"member-avatar.png": png, "member.txt": "user\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			result := runCLI(t, dir, "y\n", append(tt.args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedWords(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		text          string
+		want          string
+	}{
+		{name: "prefix and suffix", before: "user", after: "member", text: "preUserData\n", want: "preMemberData\n"},
+		{name: "call", before: "user", after: "member", text: "getUser()\n", want: "getMember()\n"},
+		{name: "by id", before: "user", after: "member", text: "getUserById(id)\n", want: "getMemberById(id)\n"},
+		{name: "leading", before: "user", after: "member", text: "userById UserById\n", want: "memberById MemberById\n"},
+		{name: "snake", before: "user", after: "member", text: "get_user_by_id GET_USER_BY_ID\n", want: "get_member_by_id GET_MEMBER_BY_ID\n"},
+		{name: "multiple words", before: "user-profile", after: "member-account", text: "getUserProfileById(id)\nload_user_profile()\n", want: "getMemberAccountById(id)\nload_member_account()\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := parseOptions(t, tt.before, tt.after)
+			if got, _ := replaceContent("a.go", tt.text, generateDictForText(opts.before, opts.after), opts); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrimDict(t *testing.T) {
+	d := generateDictForText("user", "member")
+	befores := func(d dict) []string {
+		var words []string
+		for _, it := range d.items {
+			words = append(words, it.before)
+		}
+		return words
+	}
+	if got := befores(d.trimmedIf(false)); !reflect.DeepEqual(got, befores(d)) {
+		t.Errorf("got %v, want %v", got, befores(d))
+	}
+	// The form identical to the raw input is kept once
+	want := []string{"User", "user", "USER"}
+	if got := befores(d.trimmedIf(true)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v (from %v)", got, want, befores(d))
+	}
+
+	// The same words are replaced with the trimmed dictionary
+	const text = "User user USER\n"
+	for _, args := range [][]string{nil, {"-trim-dict"}} {
+		if got := replaceString(t, "a.txt", text, append(args, "user", "member")...); got != "Member member MEMBER\n" {
+			t.Errorf("%v: got %q", args, got)
+		}
+	}
+	result := runCLI(t, writeTree(t, map[string]string{"a.txt": text}), "n\n", "-trim-dict", "user", "member")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	// Both of the printed dictionaries for text and file names are trimmed
+	if strings.Contains(result.stdout, "dictionary is ambiguous") || strings.Count(result.stdout, `"user" => "member"`) != 2 {
+		t.Errorf("got %q", result.stdout)
+	}
+
+	// So are the written dictionaries
+	dir := writeTree(t, map[string]string{"a.txt": text})
+	if result := runCLI(t, dir, "", "-dry-run", "-trim-dict", "-dictionary-out", "dict.json", "user", "member"); result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	bs, err := os.ReadFile(filepath.Join(dir, "dict.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written map[string][]map[string]string
+	if err := json.Unmarshal(bs, &written); err != nil {
+		t.Fatalf("%s: %s", err, bs)
+	}
+	if len(written) != 2 {
+		t.Fatalf("got %v", written)
+	}
+	for kind, items := range written {
+		var got []string
+		for _, item := range items {
+			got = append(got, item["before"])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestDebugDetect(t *testing.T) {
+	files := map[string]string{"a.txt": "user\n", "b.bin": "user\x00", "c.png": "\x89PNG\r\n\x1a\n\x00", "d.md": "user\n"}
+	dir := writeTree(t, files)
+	// The words can be omitted
+	result := runCLI(t, dir, "", "-debug-detect", "-force-text", "*.png", "-exclude", "*.md")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	want := "a.txt\ttext/plain; charset=utf-8\tincluded\n" +
+		"b.bin\tapplication/octet-stream\tskipped: binary\n" +
+		"c.png\timage/png\tincluded: forced\n" +
+		// An excluded file is not read
+		"d.md\t-\tskipped: excluded\n"
+	if result.stdout != want {
+		t.Errorf("got %q, want %q", result.stdout, want)
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+		t.Errorf("changed: %v", got)
+	}
+}
+
+func TestFilesFromOutsideDir(t *testing.T) {
+	files := map[string]string{"work/in/user.txt": "user\n", "work/unlisted.txt": "user\n", "outside/user.txt": "user\n"}
+	for _, answer := range []string{"n", "y"} {
+		t.Run(answer, func(t *testing.T) {
+			dir := writeTree(t, files)
+			other := writeTree(t, map[string]string{"user.txt": "user\n"})
+			// The listed paths are used as they are from the working dir, even outside it
+			paths := []string{filepath.Join("in", "user.txt"), filepath.Join("..", "outside", "user.txt"), absPath(t, filepath.Join(other, "user.txt"))}
+			list := filepath.Join(t.TempDir(), "list.txt")
+			if err := os.WriteFile(list, []byte(strings.Join(paths, "\n")+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			result := runCLI(t, filepath.Join(dir, "work"), answer+"\n", "-files-from", list, "user", "member")
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+
+			want := map[string]string{"work/in/member.txt": "member\n", "work/unlisted.txt": "user\n", "outside/member.txt": "member\n"}
+			wantOther := map[string]string{"member.txt": "member\n"}
+			if answer == "n" {
+				want, wantOther = files, map[string]string{"user.txt": "user\n"}
+			} else {
+				for _, path := range paths {
+					if diff := "--- a/" + path + "\n+++ b/" + path + "\n@@ -1 +1 @@\n-user\n+member\n"; !strings.Contains(result.stdout, diff) {
+						t.Errorf("no diff of %s: %q", path, result.stdout)
+					}
+				}
+			}
+			if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+			if got := readTree(t, other); !reflect.DeepEqual(got, wantOther) {
+				t.Errorf("got %v, want %v", got, wantOther)
+			}
+		})
+	}
+}
+
+func TestNormalizeSep(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"user_profile.go":           "var user_profile = \"user-profile\"\n",
+		"user-profile.md":           "user_profile\n",
+		"USER_PROFILE/USER-PROFILE": "",
+		"user_profile_test/a.txt":   "",
+	})
+	result := runCLI(t, dir, "y\n", "-normalize-sep", "-", "user-profile", "member-account")
+	if result.code != 0 {
+		t.Fatalf("exit code %d: %s", result.code, result.stderr)
+	}
+	// Only the file names are normalized, and the text is replaced in each form
+	want := map[string]string{
+		"member-account.go":             "var member_account = \"member-account\"\n",
+		"member-account.md":             "member_account\n",
+		"MEMBER-ACCOUNT/MEMBER-ACCOUNT": "",
+		"member-account_test/a.txt":     "",
+	}
+	if got := readTree(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	files := map[string]string{
+		"a.txt": "user user\n",
+		"b.txt": "nothing\n",
+		"c.bin": "user\x00",
+		"d.txt": "user\n",
+		"e.md":  strings.Repeat("user\n", 11),
+		"f.log": "user\n",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "categories",
+			want: "a.txt: would change (2)\n" +
+				"b.txt: no match\n" +
+				"c.bin: skipped: binary\n" +
+				"d.txt: skipped: excluded\n" +
+				"e.md: skipped: too many replacements\n" +
+				"f.log: skipped: not included\n",
+		},
+		{
+			name: "rename binary",
+			args: []string{"-rename-binary"},
+			want: "a.txt: would change (2)\n" +
+				"b.txt: no match\n" +
+				"c.bin: rename only: binary\n" +
+				"d.txt: skipped: excluded\n" +
+				"e.md: skipped: too many replacements\n" +
+				"f.log: skipped: not included\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTree(t, files)
+			args := append([]string{"-outcomes", "-exclude", "d.txt", "-include", "*.txt,*.bin,*.md", "-max-replacements-per-file", "10"}, tt.args...)
+			result := runCLI(t, dir, "", append(args, "user", "member")...)
+			if result.code != 0 {
+				t.Fatalf("exit code %d: %s", result.code, result.stderr)
+			}
+			_, got, _ := strings.Cut(result.stdout, ">> Outcomes\n")
+			got, _, _ = strings.Cut(got, ">>")
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// Nothing is changed as a dry run
+			if got := readTree(t, dir); !reflect.DeepEqual(got, files) {
+				t.Errorf("changed: %v", got)
+			}
+		})
+	}
+}
+
+func TestHTMLAttr(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		text string
+		want string
+	}{
+		{
+			name: "attribute and text",
+			path: "a.html",
+			text: `<div class="user-card" id="user">user-card</div>` + "\n",
+			want: `<div class="member-card" id="user">user-card</div>` + "\n",
+		},
+		{
+			name: "quotes",
+			path: "a.html",
+			text: `<p class='user x'><br class=user/><span CLASS = "User">` + "\n",
+			want: `<p class='member x'><br class=member/><span CLASS = "Member">` + "\n",
+		},
+		{
+			// An attribute whose name ends with the name doesn't match
+			name: "similar attribute",
+			path: "a.html",
+			text: `<div data-class="user" class="user">` + "\n",
+			want: `<div data-class="user" class="member">` + "\n",
+		},
+		{
+			name: "comment and end tag",
+			path: "a.html",
+			text: `<!-- class="user" --><user class="user"></user>` + "\n",
+			want: `<!-- class="user" --><user class="member"></user>` + "\n",
+		},
+		{
+			name: "xml",
+			path: "a.svg",
+			text: `<svg><g class="user"><text>user</text></g></svg>` + "\n",
+			want: `<svg><g class="member"><text>user</text></g></svg>` + "\n",
+		},
+		{
+			// Other files are replaced as usual
+			name: "not html",
+			path: "a.go",
+			text: `const x = "<div class=\"user\">user</div>"` + "\n",
+			want: `const x = "<div class=\"member\">member</div>"` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceString(t, tt.path, tt.text, "-html-attr", "class", "user", "member"); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := tryParseOptions(t, "-html-attr", `class"`, "user", "member"); err == nil {
+		t.Error("invalid attribute name is accepted")
+	}
+}